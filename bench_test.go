@@ -69,6 +69,115 @@ func BenchmarkConnect(b *testing.B) {
 	})
 }
 
+func BenchmarkSmallMessage(b *testing.B) {
+	mux := http.NewServeMux()
+	mux.Handle(
+		pingv1connect.NewPingServiceHandler(
+			pingServer{},
+		),
+	)
+	server := newHTTP2Server(b, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	b.ResetTimer()
+
+	// Unary RPCs buffer the request rather than streaming it through a pipe, so
+	// compare them to client streams sending a single message.
+	b.Run("unary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := client.Ping(
+				context.Background(),
+				connect.NewRequest(&pingv1.PingRequest{Number: 42}),
+			)
+			assert.Nil(b, err)
+		}
+	})
+	// Unary gRPC handlers write the response and trailers in one flush; the
+	// parallel variant shows the effect under load.
+	grpcClient := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+	b.Run("grpc_unary", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, err := grpcClient.Ping(
+					context.Background(),
+					connect.NewRequest(&pingv1.PingRequest{Number: 42}),
+				)
+				assert.Nil(b, err)
+			}
+		})
+	})
+	b.Run("client_stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			stream := client.Sum(context.Background())
+			assert.Nil(b, stream.Send(&pingv1.SumRequest{Number: 42}))
+			_, err := stream.CloseAndReceive()
+			assert.Nil(b, err)
+		}
+	})
+}
+
+// BenchmarkHandlerUnary calls the handler directly, without a network, so
+// the per-RPC overhead of the handler itself isn't lost in the noise.
+func BenchmarkHandlerUnary(b *testing.B) {
+	_, handler := pingv1connect.NewPingServiceHandler(pingServer{})
+	body := []byte(`{"number":"42"}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		request := httptest.NewRequest(
+			http.MethodPost,
+			pingv1connect.PingServicePingProcedure,
+			bytes.NewReader(body),
+		)
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			b.Fatalf("response status: %d", recorder.Code)
+		}
+	}
+}
+
+func BenchmarkServerStreamReuseMsg(b *testing.B) {
+	const messages = 100_000
+	mux := http.NewServeMux()
+	mux.Handle(
+		pingv1connect.NewPingServiceHandler(
+			pingServer{},
+		),
+	)
+	server := newHTTP2Server(b, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	b.ResetTimer()
+
+	for _, reuse := range []bool{false, true} {
+		name := "allocate"
+		if reuse {
+			name = "reuse"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				stream, err := client.CountUp(
+					context.Background(),
+					connect.NewRequest(&pingv1.CountUpRequest{Number: messages}),
+				)
+				assert.Nil(b, err)
+				stream.SetReuseMsg(reuse)
+				var sum int64
+				for stream.Receive() {
+					sum += stream.Msg().GetNumber()
+				}
+				assert.Nil(b, stream.Err())
+				assert.Nil(b, stream.Close())
+				assert.Equal(b, sum, messages*(messages+1)/2)
+			}
+		})
+	}
+}
+
 type ping struct {
 	Text string `json:"text"`
 }
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // Client is a reusable, concurrency-safe client for a single procedure.
@@ -54,17 +55,24 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 				config.CompressionPools,
 				config.CompressionNames,
 			),
-			Codec:            config.Codec,
-			Protobuf:         config.protobuf(),
-			CompressMinBytes: config.CompressMinBytes,
-			HTTPClient:       httpClient,
-			URL:              config.URL,
-			BufferPool:       config.BufferPool,
-			ReadMaxBytes:     config.ReadMaxBytes,
-			SendMaxBytes:     config.SendMaxBytes,
-			EnableGet:        config.EnableGet,
-			GetURLMaxBytes:   config.GetURLMaxBytes,
-			GetUseFallback:   config.GetUseFallback,
+			Codec:              config.Codec,
+			Protobuf:           config.protobuf(),
+			CompressMinBytes:   config.CompressMinBytes,
+			HTTPClient:         httpClient,
+			URL:                config.URL,
+			BufferPool:         config.BufferPool,
+			ReadMaxBytes:       config.ReadMaxBytes,
+			ReadMaxStreamBytes: config.ReadMaxStreamBytes,
+			SendMaxBytes:       config.SendMaxBytes,
+			EnableGet:          config.EnableGet,
+			GetURLMaxBytes:     config.GetURLMaxBytes,
+			GetUseFallback:     config.GetUseFallback,
+			SendTimeout:        config.SendTimeout,
+			ReadLimitPerSecond: config.ReadLimitPerSecond,
+			TransportErrorCode: config.TransportErrorCode,
+			Clock:              config.Clock,
+			ContentType:        config.ContentTypeOverride,
+			OmitGRPCTimeout:    config.OmitGRPCTimeout,
 		},
 	)
 	if protocolErr != nil {
@@ -75,7 +83,7 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 	// Rather than applying unary interceptors along the hot path, we can do it
 	// once at client creation.
 	unarySpec := config.newSpec(StreamTypeUnary)
-	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+	callOnce := func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
 		conn := client.protocolClient.NewConn(ctx, unarySpec, request.Header())
 		conn.onRequestSend(func(r *http.Request) {
 			request.setRequestMethod(r.Method)
@@ -98,18 +106,63 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 			return nil, err
 		}
 		return response, conn.CloseResponse()
+	}
+	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !config.RetryPolicy.enabled() {
+			return callOnce(ctx, request)
+		}
+		return retryUnary(ctx, config.RetryPolicy, config.Clock, func() (AnyResponse, error) {
+			return callOnce(ctx, request)
+		})
 	})
 	if interceptor := config.Interceptor; interceptor != nil {
 		unaryFunc = interceptor.WrapUnary(unaryFunc)
 	}
 	client.callUnary = func(ctx context.Context, request *Request[Req]) (*Response[Res], error) {
+		if config.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = withClockTimeout(ctx, config.Clock, config.Timeout)
+			defer cancel()
+		}
+		// Validate before touching the request, so a rejected call leaves it
+		// as the caller built it.
+		if err := config.checkSendCompression(ctx); err != nil {
+			return nil, err
+		}
+		if err := checkInitialMetadata(ctx); err != nil {
+			return nil, err
+		}
 		// To make the specification, peer, and RPC headers visible to the full
 		// interceptor chain (as though they were supplied by the caller), we'll
 		// add them here.
 		request.spec = unarySpec
 		request.peer = client.protocolClient.Peer()
 		protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+		initialMetadata := initialMetadataFromContext(ctx)
+		if len(config.Header) > 0 || len(initialMetadata) > 0 || config.IdempotencyKeyHeader != "" {
+			// Client-wide headers, initial metadata, and generated idempotency
+			// keys belong to a single call, so they go on a copy of the request:
+			// callers may reuse a Request for another call. Retries reuse the
+			// copy, so every attempt carries the same key.
+			original := request
+			callRequest := *request
+			callRequest.header = request.Header().Clone()
+			mergeRequestHeaders(callRequest.header, config.Header, initialMetadata)
+			if name := config.IdempotencyKeyHeader; name != "" && callRequest.header.Get(name) == "" {
+				if err := setIdempotencyKey(callRequest.header, name); err != nil {
+					return nil, err
+				}
+			}
+			request = &callRequest
+			defer func() { original.method = callRequest.method }()
+		}
+		start := config.Clock.Now()
+		ctx, state := withRPCState(ctx)
+		state.codec.set(config.Codec.Name())
 		response, err := unaryFunc(ctx, request)
+		if config.OnFinish != nil {
+			config.OnFinish(newRPCInfo(unarySpec, config.Clock.Now().Sub(start), &state.stats, err))
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -135,7 +188,20 @@ func (c *Client[Req, Res]) CallClientStream(ctx context.Context) *ClientStreamFo
 	if c.err != nil {
 		return &ClientStreamForClient[Req, Res]{err: c.err}
 	}
-	return &ClientStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeClient, nil)}
+	if err := c.config.checkSendCompression(ctx); err != nil {
+		return &ClientStreamForClient[Req, Res]{err: err}
+	}
+	if err := checkInitialMetadata(ctx); err != nil {
+		return &ClientStreamForClient[Req, Res]{err: err}
+	}
+	ctx, state := withRPCState(ctx)
+	state.codec.set(c.config.Codec.Name())
+	return &ClientStreamForClient[Req, Res]{
+		conn:     c.newConn(ctx, StreamTypeClient, nil),
+		stats:    &state.stats,
+		send:     &state.send,
+		accepted: &state.acceptedCompression,
+	}
 }
 
 // CallServerStream calls a server streaming procedure.
@@ -143,6 +209,14 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	if c.err != nil {
 		return nil, c.err
 	}
+	if err := c.config.checkSendCompression(ctx); err != nil {
+		return nil, err
+	}
+	if err := checkInitialMetadata(ctx); err != nil {
+		return nil, err
+	}
+	ctx, state := withRPCState(ctx)
+	state.codec.set(c.config.Codec.Name())
 	conn := c.newConn(ctx, StreamTypeServer, func(r *http.Request) {
 		request.method = r.Method
 	})
@@ -160,7 +234,11 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	if err := conn.CloseRequest(); err != nil {
 		return nil, err
 	}
-	return &ServerStreamForClient[Res]{conn: conn}, nil
+	return &ServerStreamForClient[Res]{
+		conn:     conn,
+		stats:    &state.stats,
+		accepted: &state.acceptedCompression,
+	}, nil
 }
 
 // CallBidiStream calls a bidirectional streaming procedure.
@@ -168,13 +246,38 @@ func (c *Client[Req, Res]) CallBidiStream(ctx context.Context) *BidiStreamForCli
 	if c.err != nil {
 		return &BidiStreamForClient[Req, Res]{err: c.err}
 	}
-	return &BidiStreamForClient[Req, Res]{conn: c.newConn(ctx, StreamTypeBidi, nil)}
+	if err := c.config.checkSendCompression(ctx); err != nil {
+		return &BidiStreamForClient[Req, Res]{err: err}
+	}
+	if err := checkInitialMetadata(ctx); err != nil {
+		return &BidiStreamForClient[Req, Res]{err: err}
+	}
+	ctx, state := withRPCState(ctx)
+	state.codec.set(c.config.Codec.Name())
+	return &BidiStreamForClient[Req, Res]{
+		conn:     c.newConn(ctx, StreamTypeBidi, nil),
+		stats:    &state.stats,
+		send:     &state.send,
+		accepted: &state.acceptedCompression,
+	}
 }
 
 func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType, onRequestSend func(r *http.Request)) StreamingClientConn {
+	if c.config.Timeout <= 0 {
+		return c.newConnWithoutTimeout(ctx, streamType, onRequestSend)
+	}
+	ctx, cancel := withClockTimeout(ctx, c.config.Clock, c.config.Timeout)
+	return &timeoutClientConn{
+		StreamingClientConn: c.newConnWithoutTimeout(ctx, streamType, onRequestSend),
+		cancel:              cancel,
+	}
+}
+
+func (c *Client[Req, Res]) newConnWithoutTimeout(ctx context.Context, streamType StreamType, onRequestSend func(r *http.Request)) StreamingClientConn {
 	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
 		header := make(http.Header, 8) // arbitrary power of two, prevent immediate resizing
 		c.protocolClient.WriteRequestHeader(streamType, header)
+		mergeRequestHeaders(header, c.config.Header, initialMetadataFromContext(ctx))
 		conn := c.protocolClient.NewConn(ctx, spec, header)
 		conn.onRequestSend(onRequestSend)
 		return conn
@@ -182,7 +285,17 @@ func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType, o
 	if interceptor := c.config.Interceptor; interceptor != nil {
 		newConn = interceptor.WrapStreamingClient(newConn)
 	}
-	return newConn(ctx, c.config.newSpec(streamType))
+	if c.config.OnFinish == nil {
+		return newConn(ctx, c.config.newSpec(streamType))
+	}
+	start := c.config.Clock.Now()
+	return &onFinishClientConn{
+		StreamingClientConn: newConn(ctx, c.config.newSpec(streamType)),
+		onFinish:            c.config.OnFinish,
+		clock:               c.config.Clock,
+		start:               start,
+		stats:               streamStatsFromContext(ctx),
+	}
 }
 
 type clientConfig struct {
@@ -197,11 +310,24 @@ type clientConfig struct {
 	RequestCompressionName string
 	BufferPool             *bufferPool
 	ReadMaxBytes           int
+	ReadMaxStreamBytes     int
 	SendMaxBytes           int
 	EnableGet              bool
 	GetURLMaxBytes         int
 	GetUseFallback         bool
 	IdempotencyLevel       IdempotencyLevel
+	SendTimeout            time.Duration
+	Timeout                time.Duration
+	ReadLimitPerSecond     int
+	TransportErrorCode     func(error) Code
+	RetryPolicy            *RetryPolicy
+	IdempotencyKeyHeader   string
+	ContentTypeOverride    string
+	OmitGRPCTimeout        bool
+	OnFinish               func(RPCInfo)
+	Clock                  Clock
+	Header                 http.Header
+	DisableCompression     bool
 }
 
 func newClientConfig(rawURL string, options []ClientOption) (*clientConfig, *Error) {
@@ -216,18 +342,45 @@ func newClientConfig(rawURL string, options []ClientOption) (*clientConfig, *Err
 		Procedure:        protoPath,
 		CompressionPools: make(map[string]*compressionPool),
 		BufferPool:       newBufferPool(),
+		Clock:            systemClock{},
 	}
 	withProtoBinaryCodec().applyToClient(&config)
 	withGzip().applyToClient(&config)
 	for _, opt := range options {
 		opt.applyToClient(&config)
 	}
+	if config.DisableCompression {
+		// Advertising identity explicitly also stops net/http from asking for
+		// transparently gzipped responses.
+		config.CompressionPools = make(map[string]*compressionPool)
+		config.CompressionNames = []string{compressionIdentity}
+		config.RequestCompressionName = ""
+	}
 	if err := config.validate(); err != nil {
 		return nil, err
 	}
 	return &config, nil
 }
 
+// checkInitialMetadata validates any headers set with
+// ContextWithInitialMetadata.
+func checkInitialMetadata(ctx context.Context) *Error {
+	return validateRequestHeaders(initialMetadataFromContext(ctx), CodeInvalidArgument)
+}
+
+// checkSendCompression validates any request compression set with
+// ContextWithSendCompression.
+func (c *clientConfig) checkSendCompression(ctx context.Context) *Error {
+	name, ok := sendCompressionFromContext(ctx)
+	if !ok || name == compressionIdentity {
+		return nil
+	}
+	if _, ok := c.CompressionPools[name]; !ok {
+		return errorf(CodeInvalidArgument, "unknown compression %q", name)
+	}
+	return nil
+}
+
 func (c *clientConfig) validate() *Error {
 	if c.Codec == nil || c.Codec.Name() == "" {
 		return errorf(CodeUnknown, "no codec configured")
@@ -237,6 +390,31 @@ func (c *clientConfig) validate() *Error {
 			return errorf(CodeUnknown, "unknown compression %q", c.RequestCompressionName)
 		}
 	}
+	if err := c.validateContentTypeOverride(); err != nil {
+		return err
+	}
+	return validateRequestHeaders(c.Header, CodeUnknown)
+}
+
+func (c *clientConfig) validateContentTypeOverride() *Error {
+	if c.ContentTypeOverride == "" {
+		return nil
+	}
+	grpc, ok := c.Protocol.(*protocolGRPC)
+	if !ok {
+		return errorf(CodeUnknown, "content type %q: only gRPC and gRPC-Web clients can override the content type", c.ContentTypeOverride)
+	}
+	contentType := canonicalizeContentType(c.ContentTypeOverride)
+	bare, prefix := grpcContentTypeDefault, grpcContentTypePrefix
+	if grpc.web {
+		bare, prefix = grpcWebContentTypeDefault, grpcWebContentTypePrefix
+	}
+	if contentType != bare && !strings.HasPrefix(contentType, prefix) {
+		return errorf(CodeUnknown, "content type %q: must be %q or start with %q", c.ContentTypeOverride, bare, prefix)
+	}
+	if name := grpcCodecFromContentType(grpc.web, contentType); name != c.Codec.Name() {
+		return errorf(CodeUnknown, "content type %q implies codec %q, but client uses %q", c.ContentTypeOverride, name, c.Codec.Name())
+	}
 	return nil
 }
 
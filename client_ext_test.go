@@ -16,16 +16,24 @@ package connect_test
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	connect "connectrpc.com/connect"
 	"connectrpc.com/connect/internal/assert"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
 	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestNewClient_InitFailure(t *testing.T) {
@@ -206,6 +214,372 @@ func (s *notModifiedPingServer) Ping(
 	return resp, nil
 }
 
+func TestStreamWireBytes(t *testing.T) {
+	t.Parallel()
+	var serverReceived, serverSent atomic.Int64
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			_ context.Context,
+			request *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				before := stream.BytesSent()
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+				assert.True(t, stream.BytesSent() > before)
+			}
+			serverReceived.Store(stream.BytesReceived())
+			serverSent.Store(stream.BytesSent())
+			return nil
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 5}))
+		assert.Nil(t, err)
+		var received int
+		for stream.Receive() {
+			received++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, received, 5)
+		assert.Nil(t, stream.Close())
+		assert.NotZero(t, stream.BytesSent())
+		assert.Equal(t, stream.BytesSent(), serverReceived.Load())
+		// The server finishes the stream after the handler returns, so the
+		// client sees at least as many bytes as the handler had sent.
+		assert.True(t, stream.BytesReceived() >= serverSent.Load())
+	}
+	t.Run("connect", func(t *testing.T) {
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestStreamCompressionStats(t *testing.T) {
+	t.Parallel()
+	var serverStats atomic.Value
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			sum: func(
+				_ context.Context,
+				stream *connect.ClientStream[pingv1.SumRequest],
+			) (*connect.Response[pingv1.SumResponse], error) {
+				var sum int64
+				for stream.Receive() {
+					sum += stream.Msg().Number
+				}
+				serverStats.Store(stream.CompressionStats())
+				return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), stream.Err()
+			},
+		},
+		connect.WithCompressMinBytes(1),
+	))
+	server := newHTTP2Server(t, mux)
+
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithSendGzip(), connect.WithCompressMinBytes(1))...,
+		)
+		stream := client.Sum(context.Background())
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+		}
+		response, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		stats := stream.CompressionStats()
+		// Each SumRequest is 2 bytes before compression.
+		assert.Equal(t, stats.UncompressedBytesSent, 6)
+		assert.NotZero(t, stats.CompressedBytesSent)
+		assert.True(t, stats.CompressedBytesSent != stats.UncompressedBytesSent)
+		received, ok := serverStats.Load().(connect.CompressionStats)
+		assert.True(t, ok)
+		assert.Equal(t, received.UncompressedBytesReceived, stats.UncompressedBytesSent)
+		assert.Equal(t, received.CompressedBytesReceived, stats.CompressedBytesSent)
+		assert.Equal(t, stats.UncompressedBytesReceived, int64(proto.Size(response.Msg)))
+		assert.NotZero(t, stats.CompressedBytesReceived)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		deadline := time.Now().Add(time.Hour)
+		clock := &fakeClock{now: deadline.Add(-2 * time.Second)}
+		var (
+			mu       sync.Mutex
+			timeouts []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			timeouts = append(timeouts, r.Header.Get("Grpc-Timeout")+r.Header.Get("Connect-Timeout-Ms"))
+		}))
+		t.Cleanup(server.Close)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		t.Cleanup(cancel)
+		for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithProtoJSON()} {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithClock(clock), opt)
+			_, _ = client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, timeouts, []string{"2000000u", "2000"})
+	})
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+		// With the handler's clock far in the past, every client-supplied
+		// timeout has already expired.
+		clock := &fakeClock{now: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithClock(clock)))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		t.Cleanup(cancel)
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	})
+}
+
+func TestClientWithoutGRPCTimeout(t *testing.T) {
+	t.Parallel()
+	timeouts := make(chan string, 1)
+	server := newHTTP2Server(t, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		timeouts <- r.Header.Get("Grpc-Timeout")
+		// Never respond, so only the client can end the call.
+		<-r.Context().Done()
+	}))
+	for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb()} {
+		for _, omit := range []bool{false, true} {
+			opts := []connect.ClientOption{opt}
+			if omit {
+				opts = append(opts, connect.WithoutGRPCTimeout())
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			cancel()
+			// The deadline is enforced locally either way.
+			assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+			timeout := <-timeouts
+			if omit {
+				assert.Zero(t, timeout)
+			} else {
+				assert.NotZero(t, timeout)
+			}
+		}
+	}
+}
+
+func TestClientMethodConfig(t *testing.T) {
+	t.Parallel()
+	// Handlers report whether the call arrived with a deadline.
+	hasDeadline := func(ctx context.Context) int64 {
+		if _, ok := ctx.Deadline(); ok {
+			return 1
+		}
+		return 0
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: hasDeadline(ctx)}), nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			return stream.Send(&pingv1.CountUpResponse{Number: hasDeadline(ctx)})
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	request := connect.NewRequest(&pingv1.PingRequest{Text: strings.Repeat("a", 16)})
+	t.Run("wildcard", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithMethodConfig(
+			map[string]connect.MethodConfig{
+				connect.MethodConfigWildcard: {Timeout: time.Minute},
+				// The procedure's own entry replaces the wildcard entirely.
+				pingv1connect.PingServiceCountUpProcedure: {ReadMaxBytes: 1024},
+			},
+		))
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 1)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Equal(t, stream.Msg().Number, 0)
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("service", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC(), connect.WithMethodConfig(
+			map[string]connect.MethodConfig{
+				connect.MethodConfigWildcard:               {Timeout: time.Minute},
+				"/" + pingv1connect.PingServiceName + "/*": {SendMaxBytes: 8},
+			},
+		))
+		_, err := client.Ping(context.Background(), request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+	t.Run("clock", func(t *testing.T) {
+		t.Parallel()
+		// Timeouts are measured with the client's clock.
+		var timeouts sync.Map
+		clockServer := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeouts.Store(r.URL.Path, r.Header.Get("Grpc-Timeout"))
+			mux.ServeHTTP(w, r)
+		}))
+		newClient := func(clock connect.Clock) pingv1connect.PingServiceClient {
+			return pingv1connect.NewPingServiceClient(
+				clockServer.Client(),
+				clockServer.URL,
+				connect.WithGRPC(),
+				connect.WithClock(clock),
+				connect.WithMethodConfig(map[string]connect.MethodConfig{
+					connect.MethodConfigWildcard: {Timeout: time.Minute},
+				}),
+			)
+		}
+		client := newClient(&fakeClock{now: time.Unix(0, 0)})
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+		for _, procedure := range []string{pingv1connect.PingServicePingProcedure, pingv1connect.PingServiceCountUpProcedure} {
+			value, _ := timeouts.Load(procedure)
+			timeout, _ := value.(string)
+			assert.Equal(t, timeout, "60000m")
+		}
+		// Calls time out when the clock's timer fires.
+		client = newClient(&firingClock{})
+		_, err = client.Ping(context.Background(), request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	})
+	t.Run("streaming_timeout", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithMethodConfig(
+			map[string]connect.MethodConfig{
+				pingv1connect.PingServiceCountUpProcedure: {Timeout: time.Minute},
+			},
+		))
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Equal(t, stream.Msg().Number, 1)
+		assert.Nil(t, stream.Close())
+	})
+}
+
+func TestClientStreamServerErrorMidStream(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		sum: func(
+			_ context.Context,
+			stream *connect.ClientStream[pingv1.SumRequest],
+		) (*connect.Response[pingv1.SumResponse], error) {
+			// Stop reading after the first message and fail the RPC.
+			assert.True(t, stream.Receive())
+			return nil, connect.NewError(connect.CodeFailedPrecondition, errors.New("enough"))
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream := client.Sum(context.Background())
+		for i := 0; i < 3; i++ {
+			// Once the server has responded, Send returns an error wrapping io.EOF
+			// and the real error is available from CloseAndReceive.
+			if err := stream.Send(&pingv1.SumRequest{Number: int64(i)}); err != nil {
+				assert.ErrorIs(t, err, io.EOF)
+				break
+			}
+		}
+		_, err := stream.CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestReceiveDeadlineExceeded(t *testing.T) {
+	t.Parallel()
+	unblock := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			_ context.Context,
+			_ *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			// Stall without watching the context, so the client's deadline
+			// expires while it's blocked reading the response body.
+			<-unblock
+			return nil
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	t.Cleanup(func() { close(unblock) })
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeDeadlineExceeded)
+		_ = stream.Close()
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
 type assertPeerInterceptor struct {
 	tb testing.TB
 }
@@ -236,3 +610,853 @@ func (a *assertPeerInterceptor) WrapStreamingHandler(next connect.StreamingHandl
 		return next(ctx, conn)
 	}
 }
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Until(t time.Time) time.Duration {
+	return t.Sub(c.now)
+}
+
+func (c *fakeClock) NewTimer(time.Duration) connect.Timer {
+	return &fakeTimer{c: make(chan time.Time)}
+}
+
+// firingClock is a fakeClock whose timers fire right away.
+type firingClock struct {
+	fakeClock
+}
+
+func (c *firingClock) NewTimer(time.Duration) connect.Timer {
+	timer := &fakeTimer{c: make(chan time.Time, 1)}
+	timer.c <- c.now
+	return timer
+}
+
+type fakeTimer struct {
+	c chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return true
+}
+
+func TestServerStreamReceiveAll(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	countUp := func(t *testing.T, number int64) *connect.ServerStreamForClient[pingv1.CountUpResponse] {
+		t.Helper()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+		assert.Nil(t, err)
+		return stream
+	}
+	numbers := func(messages []*pingv1.CountUpResponse) []int64 {
+		var numbers []int64
+		for _, msg := range messages {
+			numbers = append(numbers, msg.GetNumber())
+		}
+		return numbers
+	}
+
+	messages, err := countUp(t, 3).ReceiveAll(0)
+	assert.Nil(t, err)
+	assert.Equal(t, numbers(messages), []int64{1, 2, 3})
+
+	messages, err = countUp(t, 3).ReceiveAll(3)
+	assert.Nil(t, err)
+	assert.Equal(t, len(messages), 3)
+
+	messages, err = countUp(t, 3).ReceiveAll(2)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	assert.Equal(t, numbers(messages), []int64{1, 2})
+
+	// Errors from the server are returned, too.
+	messages, err = countUp(t, 0).ReceiveAll(0)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	assert.Equal(t, len(messages), 0)
+}
+
+func TestClientStreamFinalError(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			_ context.Context,
+			request *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			for i := int64(1); i <= request.Msg.GetNumber(); i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			if request.Msg.GetNumber() > 2 {
+				return connect.NewError(connect.CodeDataLoss, errors.New("too many"))
+			}
+			return nil
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: request.GetNumber()}); err != nil {
+					return err
+				}
+			}
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		for number, want := range map[int64]connect.Code{2: 0, 3: connect.CodeDataLoss} {
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+			assert.Nil(t, err)
+			assert.True(t, stream.Receive())
+			err = stream.FinalError()
+			if want == 0 {
+				assert.Nil(t, err)
+			} else {
+				assert.Equal(t, connect.CodeOf(err), want)
+			}
+			assert.False(t, stream.Receive())
+			assert.True(t, stream.Err() == err)
+			assert.Equal(t, stream.Msg().GetNumber(), 1)
+			assert.Nil(t, stream.Close())
+		}
+
+		bidi := client.CumSum(context.Background())
+		assert.Nil(t, bidi.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, bidi.Send(&pingv1.CumSumRequest{Number: 2}))
+		assert.Nil(t, bidi.CloseRequest())
+		assert.Nil(t, bidi.FinalError())
+		assert.Nil(t, bidi.CloseResponse())
+	}
+}
+
+func TestGRPCWebClientMissingTrailerFrame(t *testing.T) {
+	t.Parallel()
+	message, err := proto.Marshal(&pingv1.CountUpResponse{Number: 1})
+	assert.Nil(t, err)
+	// The server sends a data frame but never the 0x80-flagged trailer frame
+	// carrying the gRPC status.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		prefix := [5]byte{}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+		_, _ = w.Write(prefix[:])
+		_, _ = w.Write(message)
+	}))
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPCWeb())
+
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.Equal(t, stream.Msg().GetNumber(), 1)
+	assert.False(t, stream.Receive())
+	assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInternal)
+	assert.True(t, strings.Contains(stream.Err().Error(), "no Grpc-Status trailer"))
+	assert.Nil(t, stream.Close())
+
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+}
+
+func TestGRPCClientTrailersOnlyStatusInHeaders(t *testing.T) {
+	t.Parallel()
+	message, err := proto.Marshal(&pingv1.PingResponse{Number: 1})
+	assert.Nil(t, err)
+	// Some servers and proxies (like Envoy) send unary errors as a 200 with
+	// the status in the headers. A non-OK status in the headers makes the
+	// response trailers-only, so any body is ignored.
+	for _, withBody := range []bool{false, true} {
+		withBody := withBody
+		t.Run(fmt.Sprintf("body_%t", withBody), func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/grpc")
+				w.Header().Set("Grpc-Status", "5")
+				w.Header().Set("Grpc-Message", "no such ping")
+				w.WriteHeader(http.StatusOK)
+				if withBody {
+					prefix := [5]byte{}
+					binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+					_, _ = w.Write(prefix[:])
+					_, _ = w.Write(message)
+				}
+			}))
+			t.Cleanup(server.Close)
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Message(), "no such ping")
+		})
+	}
+}
+
+func TestClientWithHeaders(t *testing.T) {
+	t.Parallel()
+	checkHeader := func(header http.Header) error {
+		if got := header.Values("X-Api-Key"); len(got) != 1 || got[0] != "secret" {
+			return connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("got API keys %v", got))
+		}
+		if got := header.Values("X-Tenant"); len(got) != 2 {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("got tenants %v", got))
+		}
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if err := checkHeader(request.Header()); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			if err := checkHeader(stream.RequestHeader()); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.SumResponse{}), nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithHeader("x-api-key", "secret"),
+		connect.WithHeaders(http.Header{"X-Tenant": []string{"acme"}}),
+	)
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	request.Header().Add("X-Tenant", "umbrella")
+	// Reused requests don't accumulate the client's headers.
+	for i := 0; i < 3; i++ {
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, request.Header().Values("X-Tenant"), []string{"umbrella"})
+	assert.Equal(t, request.Header().Values("X-Api-Key"), nil)
+	stream := client.Sum(context.Background())
+	stream.RequestHeader().Add("X-Tenant", "umbrella")
+	_, err := stream.CloseAndReceive()
+	assert.Nil(t, err)
+
+	for _, option := range []connect.ClientOption{
+		connect.WithHeader("Grpc-Timeout", "1S"),
+		connect.WithHeader("content-type", "application/json"),
+		connect.WithHeader("Bad Name", "value"),
+		connect.WithHeader("X-Smuggled", "value\r\nX-Other: value"),
+	} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, option)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestGRPCFramingErrorIncludesTrailers(t *testing.T) {
+	t.Parallel()
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "X-Error-Id")
+		w.WriteHeader(http.StatusOK)
+		// A message that isn't valid protobuf, followed by a diagnostic trailer
+		// but no Grpc-Status.
+		_, _ = w.Write([]byte{0, 0, 0, 0, 1, 0xff})
+		w.Header().Set("X-Error-Id", "abc123")
+	}))
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	var connectErr *connect.Error
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+	assert.Equal(t, connectErr.Meta().Get("X-Error-Id"), "abc123")
+}
+
+func TestClientSendTimeout(t *testing.T) {
+	t.Parallel()
+	// The server never reads the request body, so flow control eventually
+	// blocks the client's sends.
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		opts := append(opts, connect.WithSendTimeout(100*time.Millisecond))
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL+pingv1connect.PingServicePingProcedure,
+			opts...,
+		)
+		stream := client.CallClientStream(context.Background())
+		request := &pingv1.PingRequest{Text: strings.Repeat("a", 64*1024)}
+		var err error
+		for i := 0; i < 1024 && err == nil; i++ {
+			err = stream.Send(request)
+		}
+		assert.NotNil(t, err)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		// The timeout aborts the whole stream.
+		assert.NotNil(t, stream.Send(request))
+		_, err = stream.CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	}
+}
+
+func TestClientSendTimeoutIgnoresFinishedWrites(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := newHTTP2Server(t, mux)
+	clock := &recordingClock{}
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithClock(clock),
+		connect.WithSendTimeout(time.Minute),
+	)
+	stream := client.Sum(context.Background())
+	for i := int64(1); i <= 3; i++ {
+		assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: i}))
+		// The write has finished, so its timer firing late must not abort
+		// the stream.
+		clock.fireAll()
+	}
+	response, err := stream.CloseAndReceive()
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.GetSum(), int64(6))
+}
+
+// recordingClock is a system clock whose timers only fire when the test
+// says so.
+type recordingClock struct {
+	mu     sync.Mutex
+	timers []*fakeTimer
+}
+
+func (c *recordingClock) Now() time.Time                  { return time.Now() }
+func (c *recordingClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+func (c *recordingClock) NewTimer(time.Duration) connect.Timer {
+	timer := &fakeTimer{c: make(chan time.Time, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (c *recordingClock) fireAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, timer := range c.timers {
+		select {
+		case timer.c <- time.Now():
+		default:
+		}
+	}
+}
+
+func TestClientStreamSendErr(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		sum: func(ctx context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, errors.New("no thanks"))
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream := client.Sum(context.Background())
+		assert.Nil(t, stream.SendErr())
+		_ = stream.Send(&pingv1.SumRequest{Number: 1})
+		deadline := time.Now().Add(5 * time.Second)
+		for stream.SendErr() == nil && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.ErrorIs(t, stream.SendErr(), io.EOF)
+		_, err := stream.CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if calls.Add(1) < 3 {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("try again"))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	policy := connect.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		calls.Store(0)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithRetryPolicy(policy))...,
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+		assert.Equal(t, calls.Load(), 3)
+		// Without retries, the first failure is final.
+		calls.Store(0)
+		client = pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, calls.Load(), 1)
+	}
+}
+
+func TestClientIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				mu.Lock()
+				defer mu.Unlock()
+				keys = append(keys, request.Header().Get("Request-Key"))
+				if len(keys) == 1 {
+					return nil, connect.NewError(connect.CodeUnavailable, errors.New("try again"))
+				}
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+		},
+		connect.WithInterceptors(connect.NewServerDedupInterceptor("Request-Key", time.Hour)),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	seen := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+	policy := connect.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithRetryPolicy(policy),
+		connect.WithIdempotencyKeyHeader("Request-Key"),
+	)
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	_, err := client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	// The failed attempt released its key, and the retry reused it.
+	got := seen()
+	assert.Equal(t, len(got), 2)
+	assert.NotZero(t, got[0])
+	assert.Equal(t, got[1], got[0])
+	// Generated keys don't stick to the request, so reusing it is a new call
+	// with a new key.
+	assert.Zero(t, request.Header().Get("Request-Key"))
+	_, err = client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	got = seen()
+	assert.Equal(t, len(got), 3)
+	assert.NotEqual(t, got[2], got[0])
+	// Replaying a call that succeeded with a key supplied by the caller is
+	// rejected without running it, even without retries.
+	request = connect.NewRequest(&pingv1.PingRequest{})
+	request.Header().Set("Request-Key", "replayed")
+	_, err = client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	_, err = client.Ping(context.Background(), request)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeAlreadyExists)
+	assert.Equal(t, len(seen()), 4)
+}
+
+func TestOnFinish(t *testing.T) {
+	t.Parallel()
+	handlerInfos := make(chan connect.RPCInfo, 10)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithOnFinish(func(info connect.RPCInfo) { handlerInfos <- info }),
+	))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		clientInfos := make(chan connect.RPCInfo, 10)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithOnFinish(func(info connect.RPCInfo) { clientInfos <- info }))...,
+		)
+		checkInfo := func(info connect.RPCInfo, procedure string, code connect.Code) {
+			t.Helper()
+			assert.Equal(t, info.Spec.Procedure, procedure)
+			assert.Equal(t, info.Code, code)
+			assert.Equal(t, info.Err == nil, code == 0)
+			assert.True(t, info.Duration > 0)
+			if code == 0 {
+				// Failed gRPC calls may not have a body at all.
+				assert.NotZero(t, info.BytesSent)
+				assert.NotZero(t, info.BytesReceived)
+			}
+		}
+
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		checkInfo(<-clientInfos, pingv1connect.PingServicePingProcedure, 0)
+		info := <-handlerInfos
+		checkInfo(info, pingv1connect.PingServicePingProcedure, 0)
+		assert.False(t, info.Spec.IsClient)
+
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeNotFound)}))
+		assert.NotNil(t, err)
+		checkInfo(<-clientInfos, pingv1connect.PingServiceFailProcedure, connect.CodeNotFound)
+		checkInfo(<-handlerInfos, pingv1connect.PingServiceFailProcedure, connect.CodeNotFound)
+
+		// Reaching the end of the stream finishes it; closing it afterward
+		// doesn't report it again.
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+			assert.Equal(t, len(clientInfos), 0)
+		}
+		assert.Nil(t, stream.Err())
+		info = <-clientInfos
+		checkInfo(info, pingv1connect.PingServiceCountUpProcedure, 0)
+		assert.True(t, info.Spec.IsClient)
+		assert.Nil(t, stream.Close())
+		checkInfo(<-handlerInfos, pingv1connect.PingServiceCountUpProcedure, 0)
+
+		// Closing early reports the call as canceled.
+		stream, err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+		checkInfo(<-clientInfos, pingv1connect.PingServiceCountUpProcedure, connect.CodeCanceled)
+		<-handlerInfos
+		assert.Equal(t, len(clientInfos), 0)
+	}
+}
+
+func TestClientTransportErrorCode(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	// The default client doesn't trust the test server's certificate.
+	httpClient := &http.Client{}
+	request := connect.NewRequest(&pingv1.PingRequest{})
+
+	client := pingv1connect.NewPingServiceClient(httpClient, server.URL)
+	_, err := client.Ping(context.Background(), request)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+
+	client = pingv1connect.NewPingServiceClient(
+		httpClient,
+		server.URL,
+		connect.WithTransportErrorCode(func(err error) connect.Code {
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				return connect.CodeUnauthenticated
+			}
+			return connect.DefaultTransportErrorCode(err)
+		}),
+	)
+	_, err = client.Ping(context.Background(), request)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnauthenticated)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Ping(ctx, request)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+}
+
+func TestStreamAcceptedCompression(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		_, err = stream.ReceiveAll(0)
+		assert.Nil(t, err)
+		assert.Equal(t, stream.AcceptedCompression(), []string{"gzip"})
+
+		// The server's algorithms are filtered down to the ones the client
+		// supports.
+		client = pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithDisableCompression())...,
+		)
+		stream, err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		_, err = stream.ReceiveAll(0)
+		assert.Nil(t, err)
+		assert.Equal(t, len(stream.AcceptedCompression()), 0)
+	}
+}
+
+func TestStreamContentType(t *testing.T) {
+	t.Parallel()
+	handlerContentTypes := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			handlerContentTypes <- stream.ContentType()
+			_, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, testCase := range []struct {
+		opts        []connect.ClientOption
+		contentType string
+	}{
+		{nil, "application/connect+proto"},
+		{[]connect.ClientOption{connect.WithProtoJSON()}, "application/connect+json"},
+		{[]connect.ClientOption{connect.WithGRPC()}, "application/grpc+proto"},
+		{[]connect.ClientOption{connect.WithGRPC(), connect.WithProtoJSON()}, "application/grpc+json"},
+		{[]connect.ClientOption{connect.WithGRPCWeb()}, "application/grpc-web+proto"},
+	} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, testCase.opts...)
+		stream := client.CumSum(context.Background())
+		assert.Equal(t, stream.ContentType(), testCase.contentType)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Equal(t, <-handlerContentTypes, testCase.contentType)
+		_, err := stream.Receive()
+		assert.True(t, errors.Is(err, io.EOF))
+		assert.Nil(t, stream.CloseResponse())
+	}
+}
+
+func TestClientContentTypeOverride(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	var contentTypes sync.Map
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes.Store(r.Header.Get("Test-Case"), r.Header.Get("Content-Type"))
+		mux.ServeHTTP(w, r)
+	}))
+	for _, testCase := range []struct {
+		protocol    connect.ClientOption
+		contentType string
+	}{
+		{connect.WithGRPC(), "application/grpc"},
+		{connect.WithGRPC(), "application/grpc+proto"},
+		{connect.WithGRPCWeb(), "application/grpc-web"},
+		{connect.WithGRPCWeb(), "application/grpc-web+proto"},
+	} {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			testCase.protocol,
+			connect.WithContentTypeOverride(testCase.contentType),
+		)
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+		request.Header().Set("Test-Case", testCase.contentType)
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+		contentType, ok := contentTypes.Load(testCase.contentType)
+		assert.True(t, ok)
+		assert.Equal(t, contentType, any(testCase.contentType))
+	}
+	for _, opts := range [][]connect.ClientOption{
+		{connect.WithContentTypeOverride("application/proto")},
+		{connect.WithGRPC(), connect.WithContentTypeOverride("application/grpc-web")},
+		{connect.WithGRPC(), connect.WithContentTypeOverride("application/grpc+json")},
+		{connect.WithGRPCWeb(), connect.WithContentTypeOverride("application/grpc-web-text")},
+	} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+	}
+}
+
+func TestContextWithSendCompression(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	var encodings sync.Map
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var encoding string
+		for _, key := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+			encoding += r.Header.Get(key)
+		}
+		encodings.Store(r.Header.Get("Test-Case"), encoding)
+		mux.ServeHTTP(w, r)
+	}))
+	ping := func(ctx context.Context, client pingv1connect.PingServiceClient, testCase string) error {
+		request := connect.NewRequest(&pingv1.PingRequest{Text: strings.Repeat("a", 1024)})
+		request.Header().Set("Test-Case", testCase)
+		_, err := client.Ping(ctx, request)
+		return err
+	}
+	sum := func(ctx context.Context, client pingv1connect.PingServiceClient, testCase string) error {
+		stream := client.Sum(ctx)
+		stream.RequestHeader().Set("Test-Case", testCase)
+		if err := stream.Send(&pingv1.SumRequest{Number: 1}); err != nil {
+			return err
+		}
+		_, err := stream.CloseAndReceive()
+		return err
+	}
+	for i, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		gzipClient := pingv1connect.NewPingServiceClient(server.Client(), server.URL, append(opts, connect.WithSendGzip())...)
+		gzipCtx := connect.ContextWithSendCompression(context.Background(), "gzip")
+		identityCtx := connect.ContextWithSendCompression(context.Background(), "identity")
+		for _, call := range []struct {
+			name string
+			rpc  func(context.Context, pingv1connect.PingServiceClient, string) error
+		}{{"ping", ping}, {"sum", sum}} {
+			prefix := fmt.Sprintf("%d-%s-", i, call.name)
+			assert.Nil(t, call.rpc(context.Background(), client, prefix+"default"))
+			assert.Nil(t, call.rpc(gzipCtx, client, prefix+"gzip"))
+			assert.Nil(t, call.rpc(identityCtx, gzipClient, prefix+"identity"))
+			err := call.rpc(connect.ContextWithSendCompression(context.Background(), "zstd"), client, prefix+"zstd")
+			assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+
+			for testCase, want := range map[string]string{"default": "", "gzip": "gzip", "identity": ""} {
+				encoding, ok := encodings.Load(prefix + testCase)
+				assert.True(t, ok, assert.Sprintf("%s%s", prefix, testCase))
+				assert.Equal(t, encoding, any(want), assert.Sprintf("%s%s", prefix, testCase))
+			}
+			_, ok := encodings.Load(prefix + "zstd")
+			assert.False(t, ok)
+		}
+	}
+}
+
+func TestContextWithInitialMetadata(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	var headers sync.Map
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers.Store(r.Header.Get("Test-Case"), r.Header.Clone())
+		mux.ServeHTTP(w, r)
+	}))
+	ctx := connect.ContextWithInitialMetadata(context.Background(), http.Header{
+		"tenant": []string{"call"},
+		"Trace":  []string{"abc"},
+	})
+	reservedCtx := connect.ContextWithInitialMetadata(context.Background(), http.Header{
+		"Grpc-Timeout": []string{"1S"},
+	})
+	for i, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithHeaders(http.Header{"Tenant": {"client"}, "Region": {"us"}}))...,
+		)
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("Test-Case", fmt.Sprintf("%d-ping", i))
+		request.Header().Set("Trace", "request")
+		for j := 0; j < 2; j++ {
+			_, err := client.Ping(ctx, request)
+			assert.Nil(t, err)
+		}
+		// The metadata goes on a copy, so reused requests are unchanged.
+		assert.Equal(t, request.Header().Values("Trace"), []string{"request"})
+		assert.Equal(t, request.Header().Values("Tenant"), nil)
+		assert.Equal(t, request.Header().Values("Region"), nil)
+		stream := client.Sum(ctx)
+		stream.RequestHeader().Set("Test-Case", fmt.Sprintf("%d-sum", i))
+		_, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		// Initial metadata replaces the client's values, but requests' own
+		// headers are kept.
+		for testCase, trace := range map[string][]string{
+			"ping": {"request", "abc"},
+			"sum":  {"abc"},
+		} {
+			value, ok := headers.Load(fmt.Sprintf("%d-%s", i, testCase))
+			assert.True(t, ok)
+			header, _ := value.(http.Header)
+			assert.Equal(t, header.Values("Tenant"), []string{"call"})
+			assert.Equal(t, header.Values("Region"), []string{"us"})
+			assert.Equal(t, header.Values("Trace"), trace)
+		}
+
+		request = connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("Test-Case", fmt.Sprintf("%d-reserved", i))
+		_, err = client.Ping(reservedCtx, request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		// Rejected calls leave the request as the caller built it.
+		assert.Equal(t, len(request.Header()), 1)
+		_, err = client.Sum(reservedCtx).CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		_, ok := headers.Load(fmt.Sprintf("%d-reserved", i))
+		assert.False(t, ok)
+	}
+}
+
+func TestGRPCWebConcurrentStreamsWithTrailers(t *testing.T) {
+	t.Parallel()
+	// Clean ends of gRPC-Web streams share an error value internally, so
+	// metadata must not be attached to it. Each stream gets its own server so
+	// that shared connection state doesn't hide races from -race.
+	newClient := func() pingv1connect.PingServiceClient {
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				stream.ResponseTrailer().Set("Request-Id", "abc")
+				return stream.Send(&pingv1.CountUpResponse{Number: 1})
+			},
+		}))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPCWeb())
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		client := newClient()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+			assert.Nil(t, err)
+			for stream.Receive() {
+			}
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, stream.ResponseTrailer().Get("Request-Id"), "abc")
+			assert.Nil(t, stream.Close())
+		}()
+	}
+	wg.Wait()
+}
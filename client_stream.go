@@ -18,6 +18,8 @@ import (
 	"errors"
 	"io"
 	"net/http"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // ClientStreamForClient is the client's view of a client streaming RPC.
@@ -25,7 +27,10 @@ import (
 // It's returned from [Client].CallClientStream, but doesn't currently have an
 // exported constructor function.
 type ClientStreamForClient[Req, Res any] struct {
-	conn StreamingClientConn
+	conn     StreamingClientConn
+	stats    *streamStats
+	send     *sendState
+	accepted *acceptedCompression
 	// Error from client construction. If non-nil, return for all calls.
 	err error
 }
@@ -68,8 +73,25 @@ func (c *ClientStreamForClient[Req, Res]) Send(request *Req) error {
 	return c.conn.Send(request)
 }
 
+// SendErr reports, without blocking, whether Send is certain to fail. It
+// returns an error wrapping [io.EOF] once the stream can no longer send, for
+// example because the server has already returned an error, and the
+// context's error if the context is done. Checking SendErr before preparing
+// an expensive message avoids wasted work on a dead stream.
+//
+// SendErr is inherently racy: the server may end the stream at any time, so a
+// nil error doesn't guarantee that the next Send succeeds. As with Send, use
+// CloseAndReceive to get the server's error.
+func (c *ClientStreamForClient[Req, Res]) SendErr() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.send.err()
+}
+
 // CloseAndReceive closes the send side of the stream and waits for the
-// response.
+// response. If the server returned an error, even one sent before the client
+// finished sending, CloseAndReceive returns it.
 func (c *ClientStreamForClient[Req, Res]) CloseAndReceive() (*Response[Res], error) {
 	if c.err != nil {
 		return nil, c.err
@@ -86,6 +108,46 @@ func (c *ClientStreamForClient[Req, Res]) CloseAndReceive() (*Response[Res], err
 	return response, c.conn.CloseResponse()
 }
 
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (c *ClientStreamForClient[Req, Res]) BytesSent() int64 {
+	return c.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (c *ClientStreamForClient[Req, Res]) BytesReceived() int64 {
+	return c.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (c *ClientStreamForClient[Req, Res]) CompressionStats() CompressionStats {
+	return c.stats.compression()
+}
+
+// AcceptedCompression returns the compression algorithms the server
+// advertised in its response headers that this client also supports, in the
+// order the server listed them. The order isn't necessarily a preference.
+// Clients may use it to choose request compression for later calls. It
+// returns nil until the response headers arrive, and for servers that don't
+// advertise any.
+func (c *ClientStreamForClient[Req, Res]) AcceptedCompression() []string {
+	return c.accepted.get()
+}
+
+// ContentType returns the request's Content-Type, which identifies the RPC
+// protocol and codec on the wire, like "application/grpc+proto" or
+// "application/connect+json". Responses use the same codec. The ContentType
+// methods of the other client and handler stream types behave the same way,
+// except that client streams that failed to start return an empty string.
+func (c *ClientStreamForClient[Req, Res]) ContentType() string {
+	if c.err != nil {
+		return ""
+	}
+	return getHeaderCanonical(c.conn.RequestHeader(), headerContentType)
+}
+
 // Conn exposes the underlying StreamingClientConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (c *ClientStreamForClient[Req, Res]) Conn() (StreamingClientConn, error) {
@@ -97,8 +159,11 @@ func (c *ClientStreamForClient[Req, Res]) Conn() (StreamingClientConn, error) {
 // It's returned from [Client].CallServerStream, but doesn't currently have an
 // exported constructor function.
 type ServerStreamForClient[Res any] struct {
-	conn StreamingClientConn
-	msg  *Res
+	conn     StreamingClientConn
+	msg      *Res
+	reuseMsg bool
+	stats    *streamStats
+	accepted *acceptedCompression
 	// Error from client construction. If non-nil, return for all calls.
 	constructErr error
 	// Error from conn.Receive().
@@ -111,14 +176,31 @@ type ServerStreamForClient[Res any] struct {
 // Receive returns false, the Err method will return any unexpected error
 // encountered.
 func (s *ServerStreamForClient[Res]) Receive() bool {
+	return s.receive(s.reuseMsg)
+}
+
+func (s *ServerStreamForClient[Res]) receive(reuse bool) bool {
 	if s.constructErr != nil || s.receiveErr != nil {
 		return false
 	}
-	s.msg = new(Res)
+	s.msg = nextMsg(s.msg, reuse)
 	s.receiveErr = s.conn.Receive(s.msg)
 	return s.receiveErr == nil
 }
 
+// SetReuseMsg controls whether Receive allocates a new message for each call.
+// When reuse is enabled, Receive resets the previous message and unmarshals
+// into it instead, which reduces garbage in hot loops. The message returned by
+// Msg is then only valid until the next call to Receive: callers must copy
+// out any data they need before receiving again, and must not retain the
+// message (or any of its fields) across calls. ReceiveAll ignores this
+// setting.
+//
+// By default, each call to Receive allocates a new message.
+func (s *ServerStreamForClient[Res]) SetReuseMsg(reuse bool) {
+	s.reuseMsg = reuse
+}
+
 // Msg returns the most recent message unmarshaled by a call to Receive.
 func (s *ServerStreamForClient[Res]) Msg() *Res {
 	if s.msg == nil {
@@ -164,6 +246,86 @@ func (s *ServerStreamForClient[Res]) Close() error {
 	return s.conn.CloseResponse()
 }
 
+// FinalError reads and discards any remaining messages, then returns the
+// stream's terminal error: an error sent by the server at the end of the
+// stream or a transport failure. It returns nil if the stream ended cleanly,
+// when Receive would return false and Err would return nil. FinalError blocks
+// until the stream is fully read, and it doesn't close the stream.
+//
+// After FinalError returns, Receive returns false and Err returns the same
+// error. Use it when you need the stream's outcome but not its remaining
+// messages.
+func (s *ServerStreamForClient[Res]) FinalError() error {
+	if s.constructErr != nil {
+		return s.constructErr
+	}
+	var discard *Res
+	for s.receiveErr == nil {
+		discard = nextMsg(discard, true)
+		s.receiveErr = s.conn.Receive(discard)
+	}
+	return s.Err()
+}
+
+// ReceiveAll receives every remaining message, then closes the stream. It's a
+// convenience for streams known to be short; to bound memory use, it stops
+// with a [CodeResourceExhausted] error if the server sends more than
+// maxMessages messages. A maxMessages of zero or less means no limit.
+//
+// It returns the messages received so far along with the first error from
+// Receive (including errors sent by the server at the end of the stream) or
+// Close.
+func (s *ServerStreamForClient[Res]) ReceiveAll(maxMessages int) ([]*Res, error) {
+	// The messages outlive the loop, so they can't share memory, whatever
+	// SetReuseMsg says.
+	var messages []*Res
+	for s.receive(false) {
+		if maxMessages > 0 && len(messages) >= maxMessages {
+			_ = s.Close()
+			return messages, errorf(CodeResourceExhausted, "stream has more than %d messages", maxMessages)
+		}
+		messages = append(messages, s.Msg())
+	}
+	if err := s.Err(); err != nil {
+		_ = s.Close()
+		return messages, err
+	}
+	return messages, s.Close()
+}
+
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (s *ServerStreamForClient[Res]) BytesSent() int64 {
+	return s.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (s *ServerStreamForClient[Res]) BytesReceived() int64 {
+	return s.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (s *ServerStreamForClient[Res]) CompressionStats() CompressionStats {
+	return s.stats.compression()
+}
+
+// AcceptedCompression returns the compression algorithms the server
+// accepts. See [ClientStreamForClient.AcceptedCompression].
+func (s *ServerStreamForClient[Res]) AcceptedCompression() []string {
+	return s.accepted.get()
+}
+
+// ContentType returns the request's Content-Type. See
+// [ClientStreamForClient.ContentType].
+func (s *ServerStreamForClient[Res]) ContentType() string {
+	if s.constructErr != nil {
+		return ""
+	}
+	return getHeaderCanonical(s.conn.RequestHeader(), headerContentType)
+}
+
 // Conn exposes the underlying StreamingClientConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (s *ServerStreamForClient[Res]) Conn() (StreamingClientConn, error) {
@@ -175,7 +337,10 @@ func (s *ServerStreamForClient[Res]) Conn() (StreamingClientConn, error) {
 // It's returned from [Client].CallBidiStream, but doesn't currently have an
 // exported constructor function.
 type BidiStreamForClient[Req, Res any] struct {
-	conn StreamingClientConn
+	conn     StreamingClientConn
+	stats    *streamStats
+	send     *sendState
+	accepted *acceptedCompression
 	// Error from client construction. If non-nil, return for all calls.
 	err error
 }
@@ -219,6 +384,21 @@ func (b *BidiStreamForClient[Req, Res]) Send(msg *Req) error {
 	return b.conn.Send(msg)
 }
 
+// SendErr reports, without blocking, whether Send is certain to fail. It
+// returns an error wrapping [io.EOF] once the stream can no longer send, for
+// example because the server has already returned an error or CloseRequest
+// was called, and the context's error if the context is done.
+//
+// SendErr is inherently racy: the server may end the stream at any time, so a
+// nil error doesn't guarantee that the next Send succeeds. As with Send, use
+// Receive to get the server's error.
+func (b *BidiStreamForClient[Req, Res]) SendErr() error {
+	if b.err != nil {
+		return b.err
+	}
+	return b.send.err()
+}
+
 // CloseRequest closes the send side of the stream.
 func (b *BidiStreamForClient[Req, Res]) CloseRequest() error {
 	if b.err != nil {
@@ -240,6 +420,30 @@ func (b *BidiStreamForClient[Req, Res]) Receive() (*Res, error) {
 	return &msg, nil
 }
 
+// FinalError reads and discards any remaining messages, then returns the
+// stream's terminal error: an error sent by the server at the end of the
+// stream or a transport failure. It returns nil if the stream ended cleanly,
+// when Receive would return an error wrapping [io.EOF]. FinalError blocks
+// until the server finishes the response, and it doesn't close the stream.
+//
+// Servers may wait for the client to finish sending before they end the
+// response, so call CloseRequest first.
+func (b *BidiStreamForClient[Req, Res]) FinalError() error {
+	if b.err != nil {
+		return b.err
+	}
+	var discard *Res
+	for {
+		discard = nextMsg(discard, true)
+		if err := b.conn.Receive(discard); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
 // CloseResponse closes the receive side of the stream.
 func (b *BidiStreamForClient[Req, Res]) CloseResponse() error {
 	if b.err != nil {
@@ -266,8 +470,57 @@ func (b *BidiStreamForClient[Req, Res]) ResponseTrailer() http.Header {
 	return b.conn.ResponseTrailer()
 }
 
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (b *BidiStreamForClient[Req, Res]) BytesSent() int64 {
+	return b.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (b *BidiStreamForClient[Req, Res]) BytesReceived() int64 {
+	return b.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (b *BidiStreamForClient[Req, Res]) CompressionStats() CompressionStats {
+	return b.stats.compression()
+}
+
+// AcceptedCompression returns the compression algorithms the server
+// accepts. See [ClientStreamForClient.AcceptedCompression].
+func (b *BidiStreamForClient[Req, Res]) AcceptedCompression() []string {
+	return b.accepted.get()
+}
+
+// ContentType returns the request's Content-Type. See
+// [ClientStreamForClient.ContentType].
+func (b *BidiStreamForClient[Req, Res]) ContentType() string {
+	if b.err != nil {
+		return ""
+	}
+	return getHeaderCanonical(b.conn.RequestHeader(), headerContentType)
+}
+
 // Conn exposes the underlying StreamingClientConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (b *BidiStreamForClient[Req, Res]) Conn() (StreamingClientConn, error) {
 	return b.conn, b.err
 }
+
+// nextMsg returns the message the next Receive should unmarshal into. If
+// reuse is set and there's a previous message, it's reset and returned;
+// otherwise, nextMsg allocates a new message.
+func nextMsg[T any](previous *T, reuse bool) *T {
+	if !reuse || previous == nil {
+		return new(T)
+	}
+	if msg, ok := any(previous).(proto.Message); ok {
+		proto.Reset(msg)
+	} else {
+		var zero T
+		*previous = zero
+	}
+	return previous
+}
@@ -104,3 +104,18 @@ type nopStreamingClientConn struct {
 func (c *nopStreamingClientConn) Receive(msg any) error {
 	return nil
 }
+
+func TestNextMsg(t *testing.T) {
+	t.Parallel()
+	previous := &pingv1.CountUpResponse{Number: 42}
+	fresh := nextMsg(previous, false)
+	assert.True(t, fresh != previous)
+	assert.Equal(t, previous.GetNumber(), 42)
+	reused := nextMsg(previous, true)
+	assert.True(t, reused == previous)
+	assert.Equal(t, reused.GetNumber(), 0)
+	assert.NotNil(t, nextMsg[pingv1.CountUpResponse](nil, true))
+	type plain struct{ Number int }
+	plainMsg := &plain{Number: 42}
+	assert.Equal(t, *nextMsg(plainMsg, true), plain{})
+}
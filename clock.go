@@ -0,0 +1,61 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "time"
+
+// A Clock tells the time and creates timers. Clients and handlers use it
+// wherever they need the current time, for example when converting context
+// deadlines to and from protocol-specific timeout headers.
+//
+// By default, clients and handlers use the system clock. Tests may substitute
+// their own implementation with [WithClock] to control the passage of time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Until returns the duration until t.
+	Until(t time.Time) time.Duration
+	// NewTimer creates a Timer that fires after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer is a single event created by a [Clock]. It mirrors the subset of
+// [time.Timer] that Connect uses.
+type Timer interface {
+	// C returns the channel on which the current time is delivered when the
+	// timer fires.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{timer: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time { return t.timer.C }
+
+func (t *systemTimer) Stop() bool { return t.timer.Stop() }
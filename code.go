@@ -216,11 +216,53 @@ func (c *Code) UnmarshalText(data []byte) error {
 	return fmt.Errorf("invalid code %q", dataStr)
 }
 
+// MarshalJSON implements [encoding/json.Marshaler]. Codes are always encoded
+// as strings, like "not_found" or "code_999", because the Connect protocol
+// carries them that way in error bodies.
+func (c Code) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, c.String()), nil
+}
+
+// UnmarshalJSON implements [encoding/json.Unmarshaler]. It accepts any string
+// that [Code.UnmarshalText] accepts. For convenience outside the protocol,
+// like in configuration files, it also accepts the JSON numbers of the known
+// codes, from 1 ([CodeCanceled]) to 16 ([CodeUnauthenticated]).
+func (c *Code) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		text, err := strconv.Unquote(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid code %s: %w", data, err)
+		}
+		return c.UnmarshalText([]byte(text))
+	}
+	code, err := strconv.ParseUint(string(data), 10 /* base */, 32 /* bitsize */)
+	if err != nil || code < uint64(minCode) || code > uint64(maxCode) {
+		return fmt.Errorf("invalid code %s", data)
+	}
+	*c = Code(code)
+	return nil
+}
+
 // CodeOf returns the error's status code if it is or wraps an [*Error] and
-// [CodeUnknown] otherwise.
+// [CodeUnknown] otherwise. It walks the error chain with [errors.As], so it
+// finds the nearest [*Error] even if other errors wrap it.
+//
+// Connect has no code for success, so CodeOf also returns [CodeUnknown] for
+// nil errors. Use [LookupCode] to distinguish coded errors from nil and
+// uncoded errors.
 func CodeOf(err error) Code {
 	if connectErr, ok := asError(err); ok {
 		return connectErr.Code()
 	}
 	return CodeUnknown
 }
+
+// LookupCode returns the status code of the nearest [*Error] in the error's
+// chain. If err is nil or doesn't wrap an [*Error], it returns [CodeUnknown]
+// and false.
+func LookupCode(err error) (Code, bool) {
+	if connectErr, ok := asError(err); ok {
+		return connectErr.Code(), true
+	}
+	return CodeUnknown, false
+}
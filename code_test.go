@@ -15,6 +15,7 @@
 package connect
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 	"testing"
@@ -41,6 +42,34 @@ func TestCode(t *testing.T) {
 	assertCodeRoundTrips(t, Code(999))
 }
 
+func TestCodeJSON(t *testing.T) {
+	t.Parallel()
+	for code := minCode; code <= maxCode; code++ {
+		encoded, err := json.Marshal(code)
+		assert.Nil(t, err)
+		assert.Equal(t, string(encoded), strconv.Quote(code.String()))
+		var decoded Code
+		assert.Nil(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, decoded, code)
+	}
+	// Connect error bodies carry codes as strings, even unknown ones.
+	encoded, err := json.Marshal(newConnectWireError(NewError(Code(999), nil)))
+	assert.Nil(t, err)
+	assert.Equal(t, string(encoded), `{"code":"code_999"}`)
+	var decoded connectWireError
+	assert.Nil(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, decoded.Code, Code(999))
+	var code Code
+	assert.Nil(t, json.Unmarshal([]byte(`5`), &code))
+	assert.Equal(t, code, CodeNotFound)
+	assert.NotNil(t, json.Unmarshal([]byte(`"bogus"`), &code))
+	assert.NotNil(t, json.Unmarshal([]byte(`-1`), &code))
+	// Numbers, unlike strings, are limited to the known codes.
+	assert.NotNil(t, json.Unmarshal([]byte(`0`), &code))
+	assert.NotNil(t, json.Unmarshal([]byte(`17`), &code))
+	assert.NotNil(t, json.Unmarshal([]byte(`999`), &code))
+}
+
 func assertCodeRoundTrips(tb testing.TB, code Code) {
 	tb.Helper()
 	encoded, err := code.MarshalText()
@@ -16,6 +16,8 @@ package connect
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -198,6 +200,57 @@ func (c *protoJSONCodec) IsBinary() bool {
 	return false
 }
 
+// NewAEADCodec wraps a Codec so that marshaled messages are sealed with the
+// supplied AEAD before they're framed and sent, and opened again on receipt.
+// Intermediaries that terminate TLS see only ciphertext.
+//
+// Each message is sealed with a fresh random nonce, which is prepended to the
+// ciphertext. Because nonces are random, a single key shouldn't be used for
+// more than about 2^32 messages with a 96-bit nonce AEAD like AES-GCM; rotate
+// keys well before then.
+//
+// The returned Codec's name is the wrapped codec's name with an "+aead"
+// suffix, so it's negotiated like any other codec: register it on both
+// clients and handlers with [WithCodec]. Since ciphertext isn't stable, it
+// doesn't support HTTP GET requests.
+func NewAEADCodec(codec Codec, aead cipher.AEAD) Codec {
+	return &aeadCodec{codec: codec, aead: aead}
+}
+
+type aeadCodec struct {
+	codec Codec
+	aead  cipher.AEAD
+}
+
+var _ Codec = (*aeadCodec)(nil)
+
+func (c *aeadCodec) Name() string { return c.codec.Name() + "+aead" }
+
+func (c *aeadCodec) Marshal(message any) ([]byte, error) {
+	plaintext, err := c.codec.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := c.aead.NonceSize()
+	sealed := make([]byte, nonceSize, nonceSize+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return c.aead.Seal(sealed, sealed[:nonceSize], plaintext, nil), nil
+}
+
+func (c *aeadCodec) Unmarshal(data []byte, message any) error {
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize+c.aead.Overhead() {
+		return errors.New("sealed message too short")
+	}
+	plaintext, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return fmt.Errorf("open sealed message: %w", err)
+	}
+	return c.codec.Unmarshal(plaintext, message)
+}
+
 // readOnlyCodecs is a read-only interface to a map of named codecs.
 type readOnlyCodecs interface {
 	// Get gets the Codec with the given name.
@@ -243,6 +296,30 @@ func (m *codecMap) Names() []string {
 	return names
 }
 
+// statusMarshalCodec marshals Protobuf messages, like gRPC's Status, with
+// custom options. Everything else goes to the wrapped codec.
+type statusMarshalCodec struct {
+	Codec
+
+	options proto.MarshalOptions
+}
+
+// withStatusMarshalOptions wraps the codec to marshal with the given options.
+// If options is nil, it returns the codec unchanged.
+func withStatusMarshalOptions(codec Codec, options *proto.MarshalOptions) Codec {
+	if options == nil {
+		return codec
+	}
+	return &statusMarshalCodec{Codec: codec, options: *options}
+}
+
+func (c *statusMarshalCodec) Marshal(message any) ([]byte, error) {
+	if protoMessage, ok := message.(proto.Message); ok {
+		return c.options.Marshal(protoMessage)
+	}
+	return c.Codec.Marshal(message)
+}
+
 func errNotProto(message any) error {
 	if _, ok := message.(protoiface.MessageV1); ok {
 		return fmt.Errorf("%T uses github.com/golang/protobuf, but connect-go only supports google.golang.org/protobuf: see https://go.dev/blog/protobuf-apiv2", message)
@@ -0,0 +1,59 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import "context"
+
+// CodecName returns the name of the codec used for the RPC carried by ctx,
+// such as "proto" or "json", or an empty string if ctx doesn't belong to an
+// RPC. Clients and handlers record the name before any interceptors run, so
+// it's available to code that has the context but not the stream, like
+// logging interceptors or helpers deep in a handler's call stack.
+//
+// Handlers learn the codec from the request, so CodecName returns an empty
+// string if the handler rejected the request's encoding.
+func CodecName(ctx context.Context) string {
+	return codecNameFromContext(ctx).get()
+}
+
+// codecName holds the name of an RPC's codec. Clients know the codec up
+// front, but handlers only learn it when the protocol parses the request, so
+// the holder goes into the context (as part of the RPC's rpcState) first and
+// gets filled in later.
+//
+// A nil *codecName is valid and records nothing.
+type codecName struct {
+	name string
+}
+
+func codecNameFromContext(ctx context.Context) *codecName {
+	if state := rpcStateFromContext(ctx); state != nil {
+		return &state.codec
+	}
+	return nil
+}
+
+func (n *codecName) set(name string) {
+	if n != nil {
+		n.name = name
+	}
+}
+
+func (n *codecName) get() string {
+	if n == nil {
+		return ""
+	}
+	return n.name
+}
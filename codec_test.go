@@ -16,6 +16,8 @@ package connect
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"strings"
 	"testing"
 	"testing/quick"
@@ -153,3 +155,29 @@ func TestJSONCodec(t *testing.T) {
 		)
 	})
 }
+
+func TestAEADCodec(t *testing.T) {
+	t.Parallel()
+	block, err := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	assert.Nil(t, err)
+	aead, err := cipher.NewGCM(block)
+	assert.Nil(t, err)
+	codec := NewAEADCodec(&protoBinaryCodec{}, aead)
+	assert.Equal(t, codec.Name(), "proto+aead")
+
+	want := &pingv1.PingRequest{Text: "top secret", Number: 42}
+	first, err := codec.Marshal(want)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(first, []byte("top secret")))
+	second, err := codec.Marshal(want)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Equal(first, second), assert.Sprintf("nonces must not repeat"))
+
+	var got pingv1.PingRequest
+	assert.Nil(t, codec.Unmarshal(first, &got))
+	assert.True(t, proto.Equal(&got, want))
+
+	first[len(first)-1] ^= 0xff
+	assert.NotNil(t, codec.Unmarshal(first, &got))
+	assert.NotNil(t, codec.Unmarshal(first[:aead.NonceSize()], &got))
+}
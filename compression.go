@@ -16,11 +16,13 @@ package connect
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -28,6 +30,42 @@ const (
 	compressionIdentity = "identity"
 )
 
+type sendCompressionContextKey struct{}
+
+// ContextWithSendCompression overrides the client's request compression for
+// RPCs made with the returned context, so that clients shared by mixed
+// workloads can compress only the requests that benefit. The compressor must
+// be registered with the client (see [WithAcceptCompression]); otherwise, the
+// RPC fails with [CodeInvalidArgument]. Use "identity" to send a particular
+// request uncompressed.
+//
+// Without an override, clients use the compression configured with
+// [WithSendCompression].
+func ContextWithSendCompression(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, sendCompressionContextKey{}, name)
+}
+
+// sendCompressionFromContext returns the name of the request compression set
+// with ContextWithSendCompression, if any.
+func sendCompressionFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(sendCompressionContextKey{}).(string)
+	if ok && name == "" {
+		name = compressionIdentity
+	}
+	return name, ok
+}
+
+// sendCompression chooses the request compression for a call: the override
+// from the context if there is a usable one, and the client's default
+// otherwise.
+func sendCompression(ctx context.Context, pools readOnlyCompressionPools, fallback string) string {
+	name, ok := sendCompressionFromContext(ctx)
+	if !ok || (name != compressionIdentity && !pools.Contains(name)) {
+		return fallback
+	}
+	return name
+}
+
 // A Decompressor is a reusable wrapper that decompresses an underlying data
 // source. The standard library's [*gzip.Reader] implements Decompressor.
 type Decompressor interface {
@@ -93,11 +131,18 @@ func (c *compressionPool) Decompress(dst *bytes.Buffer, src *bytes.Buffer, readM
 		return errorf(CodeInvalidArgument, "decompress: %w", err)
 	}
 	if readMaxBytes > 0 && bytesRead > readMaxBytes {
-		discardedBytes, err := io.Copy(io.Discard, decompressor)
+		// To report the message size, we'd have to decompress the rest of the
+		// message. A small, highly compressible payload (a decompression bomb)
+		// may expand to gigabytes, so we give up after decompressing twice the
+		// limit.
+		discardedBytes, err := io.Copy(io.Discard, io.LimitReader(decompressor, readMaxBytes))
 		_ = c.putDecompressor(decompressor)
 		if err != nil {
 			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", readMaxBytes, err)
 		}
+		if discardedBytes == readMaxBytes {
+			return errorf(CodeResourceExhausted, "decompressed message is more than twice the configured max %d", readMaxBytes)
+		}
 		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, readMaxBytes)
 	}
 	if err := c.putDecompressor(decompressor); err != nil {
@@ -213,3 +258,65 @@ func (m *namedCompressionPools) Contains(name string) bool {
 func (m *namedCompressionPools) CommaSeparatedNames() string {
 	return m.commaSeparatedNames
 }
+
+// acceptedCompression holds the compression names a server advertised in its
+// response headers. Clients record them here, in the RPC's rpcState, so the
+// user-facing stream types can see them through interceptors that wrap the
+// connection.
+//
+// A nil *acceptedCompression is valid and records nothing.
+type acceptedCompression struct {
+	names atomic.Pointer[[]string]
+}
+
+func acceptedCompressionFromContext(ctx context.Context) *acceptedCompression {
+	if state := rpcStateFromContext(ctx); state != nil {
+		return &state.acceptedCompression
+	}
+	return nil
+}
+
+func (a *acceptedCompression) set(names []string) {
+	if a != nil {
+		a.names.Store(&names)
+	}
+}
+
+func (a *acceptedCompression) get() []string {
+	if a == nil {
+		return nil
+	}
+	if names := a.names.Load(); names != nil {
+		return append([]string(nil), (*names)...)
+	}
+	return nil
+}
+
+// parseAcceptCompression parses a comma-separated list of compression names
+// advertised by the peer, like the value of Grpc-Accept-Encoding. It tolerates
+// extra whitespace, empty elements, and HTTP-style parameters (like ";q=0.5"),
+// and it drops duplicates and names without a matching pool. Identity is
+// always understood, so it's kept if advertised.
+func parseAcceptCompression(value string, pools readOnlyCompressionPools) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name = name[:i]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || (name != compressionIdentity && !pools.Contains(name)) {
+			continue
+		}
+		duplicate := false
+		for _, seen := range names {
+			if seen == name {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			names = append(names, name)
+		}
+	}
+	return names
+}
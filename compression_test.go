@@ -15,9 +15,11 @@
 package connect
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"connectrpc.com/connect/internal/assert"
@@ -55,6 +57,50 @@ func TestAcceptEncodingOrdering(t *testing.T) {
 	assert.True(t, called)
 }
 
+func TestParseAcceptCompression(t *testing.T) {
+	t.Parallel()
+	pools := newReadOnlyCompressionPools(
+		map[string]*compressionPool{compressionGzip: nil, "br": nil},
+		[]string{compressionGzip, "br"},
+	)
+	assert.Equal(t, parseAcceptCompression("", pools), nil)
+	assert.Equal(t, parseAcceptCompression("gzip", pools), []string{compressionGzip})
+	assert.Equal(
+		t,
+		parseAcceptCompression(" br , snappy,, GZIP;q=0.5, gzip ,identity", pools),
+		[]string{"br", compressionGzip, compressionIdentity},
+	)
+	assert.Equal(t, parseAcceptCompression("snappy, zstd", pools), nil)
+}
+
+func TestDecompressBomb(t *testing.T) {
+	t.Parallel()
+	const (
+		readMaxBytes = 1024
+		expanded     = 64 * 1024 * 1024
+	)
+	option, ok := withGzip().(*compressionOption)
+	assert.True(t, ok)
+	pool := option.CompressionPool
+	compressed := &bytes.Buffer{}
+	assert.Nil(t, pool.Compress(compressed, bytes.NewBuffer(make([]byte, expanded))))
+	assert.True(t, compressed.Len() < expanded/500)
+
+	decompressed := &bytes.Buffer{}
+	err := pool.Decompress(decompressed, compressed, readMaxBytes)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeResourceExhausted)
+	assert.Equal(t, err.Message(), "decompressed message is more than twice the configured max 1024")
+	assert.True(t, decompressed.Len() <= readMaxBytes+1)
+
+	// Modest overruns still report the full size.
+	compressed.Reset()
+	assert.Nil(t, pool.Compress(compressed, bytes.NewBuffer(make([]byte, readMaxBytes+10))))
+	err = pool.Decompress(decompressed, compressed, readMaxBytes)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Message(), "message size 1034 is larger than configured max 1024")
+}
+
 func TestClientCompressionOptionTest(t *testing.T) {
 	t.Parallel()
 	const testURL = "http://foo.bar.com/service/method"
@@ -161,3 +207,29 @@ func TestHandlerCompressionOptionTest(t *testing.T) {
 		checkPools(t, config)
 	})
 }
+
+func TestHandlerNegotiatesHTTPContentCoding(t *testing.T) {
+	t.Parallel()
+	const compressionBrotli = "br"
+	// A real brotli implementation isn't available in the standard library,
+	// but negotiation only depends on the registered name.
+	withFakeBrotli, ok := withGzip().(*compressionOption)
+	assert.True(t, ok)
+	withFakeBrotli.Name = compressionBrotli
+
+	handler := NewUnaryHandler(
+		"/connect.ping.v1.PingService/Ping",
+		func(context.Context, *Request[emptypb.Empty]) (*Response[emptypb.Empty], error) {
+			return NewResponse(&emptypb.Empty{}), nil
+		},
+		withFakeBrotli,
+	)
+	request := httptest.NewRequest(http.MethodPost, "/connect.ping.v1.PingService/Ping", strings.NewReader("{}"))
+	request.Header.Set(headerContentType, "application/json")
+	request.Header.Set(connectUnaryHeaderAcceptCompression, compressionBrotli)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get(connectUnaryHeaderCompression), compressionBrotli)
+	assert.Equal(t, recorder.Header().Get(connectUnaryHeaderAcceptCompression), compressionBrotli+","+compressionGzip)
+}
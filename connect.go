@@ -367,6 +367,10 @@ func receiveUnaryResponse[T any](conn StreamingClientConn) (*Response[T], error)
 	if err := conn.Receive(new(T)); err == nil {
 		return nil, NewError(CodeUnknown, errors.New("unary stream has multiple messages"))
 	} else if err != nil && !errors.Is(err, io.EOF) {
+		if connectErr, ok := asError(err); ok {
+			// For example, a gRPC-Web response without a trailer frame.
+			return nil, connectErr
+		}
 		return nil, NewError(CodeUnknown, err)
 	}
 	return &Response[T]{
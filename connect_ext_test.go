@@ -39,6 +39,9 @@ import (
 	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const errorMessage = "oh no"
@@ -1280,6 +1283,50 @@ func TestClientWithReadMaxBytes(t *testing.T) {
 	})
 }
 
+func TestReadMaxStreamBytes(t *testing.T) {
+	t.Parallel()
+	// Each CountUpResponse and SumRequest with a single-digit number is 2
+	// bytes, so the limit allows five messages per stream.
+	const readMaxStreamBytes = 10
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithReadMaxStreamBytes(readMaxStreamBytes),
+	))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithReadMaxStreamBytes(readMaxStreamBytes))...,
+		)
+		countUp, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 6}))
+		assert.Nil(t, err)
+		var received int
+		for countUp.Receive() {
+			received++
+		}
+		assert.Equal(t, received, 5)
+		assert.Equal(t, connect.CodeOf(countUp.Err()), connect.CodeResourceExhausted)
+		assert.Nil(t, countUp.Close())
+
+		sum := client.Sum(context.Background())
+		for i := 0; i < 6; i++ {
+			if err := sum.Send(&pingv1.SumRequest{Number: 1}); err != nil {
+				break
+			}
+		}
+		_, err = sum.CloseAndReceive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+		// Unary messages aren't limited.
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{
+			Text: strings.Repeat("a", 2*readMaxStreamBytes),
+		}))
+		assert.Nil(t, err)
+	}
+}
+
 func TestHandlerWithSendMaxBytes(t *testing.T) {
 	t.Parallel()
 	sendMaxBytes := 1024
@@ -1391,6 +1438,71 @@ func TestHandlerWithSendMaxBytes(t *testing.T) {
 	})
 }
 
+func TestErrorDetailsRoundTrip(t *testing.T) {
+	t.Parallel()
+	// Errors may carry any number of details, each of any type.
+	details := []proto.Message{
+		durationpb.New(time.Second),
+		wrapperspb.String("retry later"),
+		timestamppb.New(time.Unix(1700000000, 0)),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			err := connect.NewError(connect.CodeUnavailable, errors.New("oh no"))
+			for _, msg := range details {
+				detail, detailErr := connect.NewErrorDetail(msg)
+				if detailErr != nil {
+					return nil, detailErr
+				}
+				err.AddDetail(detail)
+			}
+			return nil, err
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, len(connectErr.Details()), len(details))
+		// Details arrive in order, and clients pick out the ones they
+		// understand by type.
+		var retryAfter *durationpb.Duration
+		for i, detail := range connectErr.Details() {
+			value, err := detail.Value()
+			assert.Nil(t, err)
+			assert.True(t, proto.Equal(value, details[i]), assert.Sprintf("detail %d: got %v", i, value))
+			if duration, ok := value.(*durationpb.Duration); ok {
+				retryAfter = duration
+			}
+		}
+		assert.Equal(t, retryAfter.AsDuration(), time.Second)
+	}
+}
+
+func TestGRPCGoMessageSizeOptions(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithMaxRecvMsgSize(16)))
+	server := newHTTP2Server(t, mux)
+	large := connect.NewRequest(&pingv1.PingRequest{Text: strings.Repeat("a", 32)})
+	t.Run("recv", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		_, err := client.Ping(context.Background(), large)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+	t.Run("send", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC(), connect.WithMaxSendMsgSize(16))
+		_, err := client.Ping(context.Background(), large)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.True(t, strings.Contains(err.Error(), "send"))
+	})
+}
+
 func TestClientWithSendMaxBytes(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -2299,6 +2411,20 @@ func TestStreamUnexpectedEOF(t *testing.T) {
 		},
 		expectCode: connect.CodeInternal,
 		expectMsg:  fmt.Sprintf("internal: corrupt response: %d extra bytes after end of stream", len(payload)+len(head)),
+	}, {
+		name:    "connect_invalid_flags",
+		options: []connect.ClientOption{connect.WithProtoJSON()},
+		handler: func(responseWriter http.ResponseWriter, _ *http.Request) {
+			_, err := responseWriter.Write(head[:])
+			assert.Nil(t, err)
+			_, err = responseWriter.Write(payload)
+			assert.Nil(t, err)
+			// A prefix with flags that no protocol uses.
+			_, err = responseWriter.Write([]byte{1 << 6, 0, 0, 0, 0})
+			assert.Nil(t, err)
+		},
+		expectCode: connect.CodeInternal,
+		expectMsg:  "internal: protocol error: invalid envelope flags 01000000",
 	}}
 	for _, testcase := range testcases {
 		testcaseMux[t.Name()+"/"+testcase.name] = testcase.handler
@@ -2327,6 +2453,41 @@ func TestStreamUnexpectedEOF(t *testing.T) {
 	}
 }
 
+func TestStreamConnectionClosedBeforeTrailers(t *testing.T) {
+	t.Parallel()
+	// Unlike the cases in TestStreamUnexpectedEOF, where the server ends the
+	// response cleanly without trailers, here the connection drops mid-stream.
+	sent := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			sent <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	http1Server := httptest.NewServer(mux)
+	t.Cleanup(http1Server.Close)
+	for _, server := range []*httptest.Server{http1Server, newHTTP2Server(t, mux)} {
+		for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+			assert.Nil(t, err)
+			assert.True(t, stream.Receive())
+			<-sent
+			server.CloseClientConnections()
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+			assert.True(t, strings.Contains(stream.Err().Error(), "connection closed before trailers"))
+			// Closing drains the broken body, so it reports the failure too.
+			_ = stream.Close()
+		}
+	}
+}
+
 // TestBlankImportCodeGeneration tests that services.connect.go is generated with
 // blank import statements to services.pb.go so that the service's Descriptor is
 // available in the global proto registry.
@@ -2413,6 +2574,17 @@ func (p *pluggablePingServer) CumSum(
 	return p.cumSum(ctx, stream)
 }
 
+// newHTTP2Server starts a TLS test server with HTTP/2 enabled, which every
+// stream type needs, and closes it when the test ends.
+func newHTTP2Server(tb testing.TB, handler http.Handler) *httptest.Server {
+	tb.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	tb.Cleanup(server.Close)
+	return server
+}
+
 func failNoHTTP2(tb testing.TB, stream *connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse]) {
 	tb.Helper()
 	if err := stream.Send(&pingv1.CumSumRequest{}); err != nil {
@@ -2669,3 +2841,89 @@ func (failCompressor) Close() error {
 }
 
 func (failCompressor) Reset(io.Writer) {}
+
+func TestSuccessDetails(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			detail, err := connect.NewErrorDetail(&pingv1.PingResponse{Text: "out of band"})
+			if err != nil {
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+			if err := connect.SetSuccessDetails(response.Trailer(), detail); err != nil {
+				return nil, err
+			}
+			if request.Msg.Number < 0 {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative"))
+			}
+			return response, nil
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		details, err := connect.SuccessDetails(response.Trailer())
+		assert.Nil(t, err)
+		assert.Equal(t, len(details), 1)
+		value, err := details[0].Value()
+		assert.Nil(t, err)
+		assert.Equal(t, value, proto.Message(&pingv1.PingResponse{Text: "out of band"}))
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+	}
+}
+
+func TestDisableCompression(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithCompression("gzip", nil, nil), // disabling wins regardless of order
+		connect.WithDisableCompression(),
+		connect.WithCompressMinBytes(0),
+	))
+	var requestHeaders sync.Map
+	server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Grpc-Encoding") == "" {
+			requestHeaders.Store(r.Header.Get("Content-Type"), r.Header.Clone())
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	newRequest := func() *connect.Request[pingv1.PingRequest] {
+		request := connect.NewRequest(&pingv1.PingRequest{Text: strings.Repeat("a", 1024)})
+		request.Header().Set(clientHeader, headerValue)
+		return request
+	}
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithDisableCompression(), connect.WithSendGzip())...,
+		)
+		response, err := client.Ping(context.Background(), newRequest())
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, strings.Repeat("a", 1024))
+		assert.Equal(t, response.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, response.Header().Get("Grpc-Encoding"), "")
+
+		// Compressed requests are rejected.
+		client = pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithSendGzip())...,
+		)
+		_, err = client.Ping(context.Background(), newRequest())
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	}
+	for _, contentType := range []string{"application/grpc+proto", "application/grpc-web+proto"} {
+		header, ok := requestHeaders.Load(contentType)
+		assert.True(t, ok)
+		assert.Equal(t, header.(http.Header).Get("Grpc-Accept-Encoding"), "identity") //nolint:forcetypeassert
+		assert.Equal(t, header.(http.Header).Get("Grpc-Encoding"), "")                //nolint:forcetypeassert
+	}
+}
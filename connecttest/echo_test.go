@@ -0,0 +1,154 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecttest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/connecttest"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+// TestBidiEcho is a reference for using bidirectional streams concurrently.
+// On both ends, one goroutine sends while another receives, which is the
+// only concurrent use the stream types support. Every message carries a
+// sequence number, so the client notices reordered and dropped messages.
+func TestBidiEcho(t *testing.T) {
+	t.Parallel()
+	const messages = 500
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(echoServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	transports := map[string]struct {
+		httpClient connect.HTTPClient
+		url        string
+	}{
+		"http2":     {server.Client(), server.URL},
+		"in_memory": {&connecttest.Transport{Handler: mux}, "http://in-memory"},
+	}
+	for transportName, transport := range transports {
+		transport := transport
+		for protocolName, opts := range map[string][]connect.ClientOption{
+			"connect":  nil,
+			"grpc":     {connect.WithGRPC()},
+			"grpc_web": {connect.WithGRPCWeb()},
+		} {
+			opts := opts
+			t.Run(transportName+"/"+protocolName, func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(transport.httpClient, transport.url, opts...)
+				assert.Nil(t, echo(context.Background(), client, messages))
+			})
+		}
+	}
+}
+
+// echo sends the numbers 1 through count on one goroutine and checks that
+// they come back in order on another.
+func echo(ctx context.Context, client pingv1connect.PingServiceClient, count int64) error {
+	stream := client.CumSum(ctx)
+	sendErr := make(chan error, 1)
+	go func() {
+		defer close(sendErr)
+		for i := int64(1); i <= count; i++ {
+			if err := stream.Send(&pingv1.CumSumRequest{Number: i}); err != nil {
+				// The server ended the stream; Receive returns the reason.
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				sendErr <- err
+				return
+			}
+		}
+		if err := stream.CloseRequest(); err != nil {
+			sendErr <- err
+		}
+	}()
+	var received int64
+	for {
+		response, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			_ = stream.CloseResponse()
+			return fmt.Errorf("receive after %d messages: %w", received, err)
+		}
+		received++
+		if response.Sum != received {
+			_ = stream.CloseResponse()
+			return fmt.Errorf("message %d: got sequence number %d", received, response.Sum)
+		}
+	}
+	if err := stream.CloseResponse(); err != nil {
+		return err
+	}
+	if err := <-sendErr; err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	if received != count {
+		return fmt.Errorf("got %d messages, expected %d", received, count)
+	}
+	return nil
+}
+
+// echoServer returns each CumSum request's number as the response's sum.
+type echoServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (echoServer) CumSum(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+	// Receive on a separate goroutine and hand messages to the sender, so
+	// receiving never waits on sending.
+	numbers := make(chan int64, 16)
+	receiveErr := make(chan error, 1)
+	go func() {
+		defer close(numbers)
+		for {
+			msg, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				receiveErr <- nil
+				return
+			} else if err != nil {
+				receiveErr <- err
+				return
+			}
+			select {
+			case numbers <- msg.Number:
+			case <-ctx.Done():
+				receiveErr <- ctx.Err()
+				return
+			}
+		}
+	}()
+	for number := range numbers {
+		if err := stream.Send(&pingv1.CumSumResponse{Sum: number}); err != nil {
+			return err
+		}
+	}
+	return <-receiveErr
+}
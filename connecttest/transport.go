@@ -0,0 +1,237 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connecttest provides a fake, in-memory transport for testing
+// Connect clients and handlers together. Combined with a fake [connect.Clock],
+// it makes tests of timeouts, retries, and transport failures deterministic:
+// requests never touch a socket, latency waits on the clock, and failures are
+// injected by attempt number.
+package connecttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	connect "connectrpc.com/connect"
+)
+
+// ErrRefusedStream is a transport error that mimics a server refusing a
+// stream with an HTTP/2 REFUSED_STREAM reset, as servers do for streams they
+// haven't started processing when they shut down gracefully or run out of
+// concurrent streams. Connect clients treat refused streams as never having
+// reached the server, so calls that fail with ErrRefusedStream are retried by
+// any [connect.RetryPolicy], even when the call isn't idempotent.
+var ErrRefusedStream error = refusedStreamError{}
+
+type refusedStreamError struct{}
+
+// Error mirrors the error net/http's HTTP/2 transport returns for refused
+// streams.
+func (refusedStreamError) Error() string {
+	return "stream error: stream ID 1; REFUSED_STREAM; received from peer"
+}
+
+// Transport is a [connect.HTTPClient] that serves requests with an
+// in-memory [http.Handler]. Responses stream in both directions, so Transport
+// supports every stream type and protocol.
+//
+// Each call to Do is an attempt, numbered from one. Before serving an attempt,
+// Transport waits for the Latency on the Clock, then asks Fail whether to fail
+// the attempt without reaching the Handler.
+//
+// A Transport must not be copied after first use.
+type Transport struct {
+	// Handler serves the requests.
+	Handler http.Handler
+	// Clock creates the timers used to simulate latency. If nil, Transport
+	// uses the system clock.
+	Clock connect.Clock
+	// Latency returns the delay before the given attempt reaches the
+	// Handler. If nil, there's no delay.
+	Latency func(attempt int) time.Duration
+	// Fail returns the error for the given attempt, or nil to serve it. If
+	// nil, no attempts fail.
+	Fail func(attempt int) error
+
+	mu       sync.Mutex
+	attempts int
+}
+
+// FailAttempts returns a Fail function that fails the listed attempts with
+// err and serves all the others.
+func FailAttempts(err error, attempts ...int) func(int) error {
+	return func(attempt int) error {
+		for _, failed := range attempts {
+			if attempt == failed {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Attempts returns the number of times Do has been called.
+func (t *Transport) Attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.attempts
+}
+
+// Do implements [connect.HTTPClient].
+func (t *Transport) Do(request *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.attempts++
+	attempt := t.attempts
+	t.mu.Unlock()
+
+	ctx := request.Context()
+	if t.Latency != nil {
+		if err := t.wait(ctx, t.Latency(attempt)); err != nil {
+			return nil, err
+		}
+	}
+	if t.Fail != nil {
+		if err := t.Fail(attempt); err != nil {
+			return nil, err
+		}
+	}
+	return t.serve(ctx, request)
+}
+
+func (t *Transport) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	var (
+		fired <-chan time.Time
+		stop  func() bool
+	)
+	if t.Clock != nil {
+		timer := t.Clock.NewTimer(delay)
+		fired, stop = timer.C(), timer.Stop
+	} else {
+		timer := time.NewTimer(delay)
+		fired, stop = timer.C, timer.Stop
+	}
+	select {
+	case <-fired:
+		return nil
+	case <-ctx.Done():
+		stop()
+		return ctx.Err()
+	}
+}
+
+func (t *Transport) serve(ctx context.Context, request *http.Request) (*http.Response, error) {
+	serverRequest := request.Clone(ctx)
+	serverRequest.Proto, serverRequest.ProtoMajor, serverRequest.ProtoMinor = "HTTP/2.0", 2, 0
+	serverRequest.RemoteAddr = "127.0.0.1:0"
+	serverRequest.RequestURI = request.URL.RequestURI()
+	if serverRequest.Host == "" {
+		serverRequest.Host = request.URL.Host
+	}
+	if serverRequest.Body == nil {
+		serverRequest.Body = http.NoBody
+	}
+	bodyReader, bodyWriter := io.Pipe()
+	writer := &responseWriter{
+		header:     make(http.Header),
+		body:       bodyWriter,
+		headerSent: make(chan struct{}),
+		response: &http.Response{
+			Proto:      "HTTP/2.0",
+			ProtoMajor: 2,
+			Body:       bodyReader,
+			Trailer:    make(http.Header),
+			Request:    request,
+		},
+	}
+	go func() {
+		defer func() {
+			writer.WriteHeader(http.StatusOK)
+			writer.finish()
+		}()
+		t.Handler.ServeHTTP(writer, serverRequest)
+	}()
+	select {
+	case <-writer.headerSent:
+		return writer.response, nil
+	case <-ctx.Done():
+		_ = bodyReader.CloseWithError(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// responseWriter streams a handler's response through a pipe. The pipe is
+// unbuffered, so writes are visible to the client as soon as they return, and
+// Flush has nothing to do.
+type responseWriter struct {
+	header     http.Header
+	body       *io.PipeWriter
+	response   *http.Response
+	headerSent chan struct{}
+	wroteCode  bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteCode {
+		return
+	}
+	w.wroteCode = true
+	w.response.StatusCode = code
+	w.response.Status = strconv.Itoa(code) + " " + http.StatusText(code)
+	w.response.Header = w.header.Clone()
+	w.response.ContentLength = -1
+	close(w.headerSent)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.body.Write(data)
+	if errors.Is(err, io.ErrClosedPipe) {
+		// The client closed the response body.
+		return n, http.ErrBodyNotAllowed
+	}
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// finish copies the trailers into the response, then ends the body. The
+// client sees the trailers once it reads to the end of the body.
+func (w *responseWriter) finish() {
+	for _, key := range w.response.Header.Values("Trailer") {
+		if values, ok := w.header[http.CanonicalHeaderKey(key)]; ok {
+			w.response.Trailer[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	for key, values := range w.header {
+		if name := strings.TrimPrefix(key, http.TrailerPrefix); name != key {
+			w.response.Trailer[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	_ = w.body.Close()
+}
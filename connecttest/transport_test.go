@@ -0,0 +1,198 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connecttest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/connecttest"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		transport := &connecttest.Transport{Handler: mux}
+		client := pingv1connect.NewPingServiceClient(transport, "http://in-memory", opts...)
+		t.Run("unary", func(t *testing.T) {
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, response.Trailer().Get("Ping-Trailer"), "done")
+		})
+		t.Run("error", func(t *testing.T) {
+			_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		})
+		t.Run("server_stream", func(t *testing.T) {
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+			assert.Nil(t, err)
+			var got []int64
+			for stream.Receive() {
+				got = append(got, stream.Msg().Number)
+			}
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, got, []int64{1, 2, 3})
+			assert.Nil(t, stream.Close())
+		})
+		t.Run("bidi_stream", func(t *testing.T) {
+			stream := client.CumSum(context.Background())
+			for i := int64(1); i <= 3; i++ {
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: i}))
+				response, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Sum, i*(i+1)/2)
+			}
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+func TestTransportRefusedStream(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	t.Run("retried", func(t *testing.T) {
+		t.Parallel()
+		transport := &connecttest.Transport{
+			Handler: mux,
+			Fail:    connecttest.FailAttempts(connecttest.ErrRefusedStream, 1),
+		}
+		client := pingv1connect.NewPingServiceClient(
+			transport,
+			"http://in-memory",
+			connect.WithRetryPolicy(connect.RetryPolicy{MaxAttempts: 2}),
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 1)
+		assert.Equal(t, transport.Attempts(), 2)
+	})
+	t.Run("no_retries", func(t *testing.T) {
+		t.Parallel()
+		transport := &connecttest.Transport{
+			Handler: mux,
+			Fail:    connecttest.FailAttempts(connecttest.ErrRefusedStream, 1),
+		}
+		client := pingv1connect.NewPingServiceClient(transport, "http://in-memory")
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, transport.Attempts(), 1)
+	})
+}
+
+func TestTransportLatency(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	clock := &manualClock{now: time.Unix(0, 0), timers: make(chan *manualTimer, 1)}
+	transport := &connecttest.Transport{
+		Handler: mux,
+		Clock:   clock,
+		Latency: func(int) time.Duration { return time.Minute },
+	}
+	client := pingv1connect.NewPingServiceClient(transport, "http://in-memory")
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		done <- err
+	}()
+	timer := <-clock.timers
+	assert.Equal(t, timer.delay, time.Minute)
+	select {
+	case <-done:
+		t.Fatal("call finished before the latency elapsed")
+	default:
+	}
+	timer.c <- clock.now.Add(timer.delay)
+	assert.Nil(t, <-done)
+}
+
+type pingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (pingServer) Ping(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+	response.Trailer().Set("Ping-Trailer", "done")
+	return response, nil
+}
+
+func (pingServer) Fail(_ context.Context, request *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+	return nil, connect.NewError(connect.Code(request.Msg.Code), errors.New("oh no"))
+}
+
+func (pingServer) CountUp(
+	_ context.Context,
+	request *connect.Request[pingv1.CountUpRequest],
+	stream *connect.ServerStream[pingv1.CountUpResponse],
+) error {
+	for i := int64(1); i <= request.Msg.Number; i++ {
+		if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pingServer) CumSum(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+	var sum int64
+	for {
+		msg, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sum += msg.Number
+		if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+			return err
+		}
+	}
+}
+
+// manualClock hands its timers to the test, which decides when they fire.
+type manualClock struct {
+	now    time.Time
+	timers chan *manualTimer
+}
+
+func (c *manualClock) Now() time.Time                  { return c.now }
+func (c *manualClock) Until(t time.Time) time.Duration { return t.Sub(c.now) }
+
+func (c *manualClock) NewTimer(d time.Duration) connect.Timer {
+	timer := &manualTimer{delay: d, c: make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer
+}
+
+type manualTimer struct {
+	delay time.Duration
+	c     chan time.Time
+}
+
+func (t *manualTimer) C() <-chan time.Time { return t.c }
+func (t *manualTimer) Stop() bool          { return true }
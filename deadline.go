@@ -0,0 +1,85 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OnDeadlineApproaching arranges for callback to run in its own goroutine once
+// the given fraction of the context's time budget has elapsed. Handlers can
+// use it to stop expensive work early and return partial results, rather than
+// failing with [CodeDeadlineExceeded] when the client's deadline passes.
+//
+// In handlers, the budget runs from the moment the request arrived until the
+// deadline set by the client's timeout header; elsewhere, it runs from the
+// call to OnDeadlineApproaching. The fraction is clamped to the range [0, 1],
+// so 0.9 runs the callback when 90% of the budget is gone. If the context
+// has no deadline, or it's done before the callback is due, callback never
+// runs.
+//
+// Calling the returned stop function cancels the callback. It returns false
+// if the callback has already been started or canceled.
+func OnDeadlineApproaching(ctx context.Context, fraction float64, callback func()) (stop func() bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return func() bool { return false }
+	}
+	var clock Clock = systemClock{}
+	var start time.Time
+	if state := rpcStateFromContext(ctx); state != nil && state.clock != nil {
+		clock, start = state.clock, state.start
+	}
+	if start.IsZero() {
+		start = clock.Now()
+	}
+	switch {
+	case fraction < 0:
+		fraction = 0
+	case fraction > 1:
+		fraction = 1
+	}
+	budget := deadline.Sub(start)
+	timer := clock.NewTimer(clock.Until(start.Add(time.Duration(float64(budget) * fraction))))
+	stopped := make(chan struct{})
+	var once sync.Once
+	go func() {
+		select {
+		case <-timer.C():
+			if ctx.Err() == nil {
+				callback()
+			}
+		case <-ctx.Done():
+			timer.Stop()
+		case <-stopped:
+		}
+	}()
+	return func() bool {
+		stoppedTimer := timer.Stop()
+		once.Do(func() { close(stopped) })
+		return stoppedTimer
+	}
+}
+
+// clockFromContext returns the clock of the handler serving ctx, or the
+// system clock outside of handlers.
+func clockFromContext(ctx context.Context) Clock {
+	if state := rpcStateFromContext(ctx); state != nil && state.clock != nil {
+		return state.clock
+	}
+	return systemClock{}
+}
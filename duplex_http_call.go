@@ -15,6 +15,7 @@
 package connect
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -22,6 +23,8 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // duplexHTTPCall is a full-duplex stream between the client and server. The
@@ -29,18 +32,40 @@ import (
 // the reverse.
 //
 // Be warned: we need to use some lesser-known APIs to do this with net/http.
+//
+// Unary calls take a faster path. Their request has a single message, so
+// rather than streaming it through a pipe to a background goroutine, we
+// buffer it and make the request synchronously in CloseWrite.
 type duplexHTTPCall struct {
 	ctx              context.Context
 	httpClient       HTTPClient
 	streamType       StreamType
 	onRequestSend    func(*http.Request)
 	validateResponse func(*http.Response) *Error
+	stats            *streamStats
+	accepted         *acceptedCompression
+
+	// If non-nil, sendWatchdog aborts the request if a Write blocks for too
+	// long.
+	sendWatchdog  *sendWatchdog
+	cancelRequest context.CancelFunc
+
+	// If non-nil, readLimiter throttles reads from the response body.
+	readLimiter *readLimiter
+
+	// If non-nil, transportErrorCode overrides the default code for errors
+	// making the HTTP request.
+	transportErrorCode func(error) Code
 
 	// We'll use a pipe as the request body. We hand the read side of the pipe to
 	// net/http, and we write to the write side (naturally). The two ends are
-	// safe to use concurrently.
+	// safe to use concurrently. Unary calls write to unaryBody instead, and
+	// the pipe is nil.
 	requestBodyReader *io.PipeReader
 	requestBodyWriter *io.PipeWriter
+	unaryBody         bytes.Buffer
+	// Set when we or net/http close the request body, after which writes fail.
+	requestBodyClosed atomic.Bool
 
 	sendRequestOnce sync.Once
 	responseReady   chan struct{}
@@ -62,7 +87,19 @@ func newDuplexHTTPCall(
 	// Request. This ensures if a transport out of our control wants
 	// to mutate the req.URL, we don't feel the effects of it.
 	url = cloneURL(url)
-	pipeReader, pipeWriter := io.Pipe()
+	call := &duplexHTTPCall{
+		ctx:           ctx,
+		httpClient:    httpClient,
+		streamType:    spec.StreamType,
+		responseReady: make(chan struct{}),
+		stats:         streamStatsFromContext(ctx),
+		accepted:      acceptedCompressionFromContext(ctx),
+	}
+	var body io.ReadCloser = http.NoBody // replaced in CloseWrite
+	if !call.isUnary() {
+		call.requestBodyReader, call.requestBodyWriter = io.Pipe()
+		body = &requestBody{PipeReader: call.requestBodyReader, closed: &call.requestBodyClosed}
+	}
 
 	// This is mirroring what http.NewRequestContext did, but
 	// using an already parsed url.URL object, rather than a string
@@ -77,23 +114,20 @@ func newDuplexHTTPCall(
 		Proto:      "HTTP/1.1",
 		ProtoMajor: 1,
 		ProtoMinor: 1,
-		Body:       pipeReader,
+		Body:       body,
 		Host:       url.Host,
 	}).WithContext(ctx)
-	return &duplexHTTPCall{
-		ctx:               ctx,
-		httpClient:        httpClient,
-		streamType:        spec.StreamType,
-		requestBodyReader: pipeReader,
-		requestBodyWriter: pipeWriter,
-		request:           request,
-		responseReady:     make(chan struct{}),
-	}
+	call.request = request
+	sendStateFromContext(ctx).track(call)
+	return call
 }
 
 // Write to the request body. Returns an error wrapping io.EOF after SetError
 // is called.
 func (d *duplexHTTPCall) Write(data []byte) (int, error) {
+	if d.isUnary() {
+		return d.writeUnary(data)
+	}
 	d.ensureRequestMade()
 	// Before we send any data, check if the context has been canceled.
 	if err := d.ctx.Err(); err != nil {
@@ -102,7 +136,8 @@ func (d *duplexHTTPCall) Write(data []byte) (int, error) {
 	}
 	// It's safe to write to this side of the pipe while net/http concurrently
 	// reads from the other side.
-	bytesWritten, err := d.requestBodyWriter.Write(data)
+	bytesWritten, err := d.writeWithTimeout(data)
+	d.stats.addSent(bytesWritten)
 	if err != nil && errors.Is(err, io.ErrClosedPipe) {
 		// Signal that the stream is closed with the more-typical io.EOF instead of
 		// io.ErrClosedPipe. This makes it easier for protocol-specific wrappers to
@@ -112,9 +147,80 @@ func (d *duplexHTTPCall) Write(data []byte) (int, error) {
 	return bytesWritten, err
 }
 
+// writeUnary buffers data for the request body.
+func (d *duplexHTTPCall) writeUnary(data []byte) (int, error) {
+	if err := d.ctx.Err(); err != nil {
+		d.SetError(err)
+		return 0, wrapIfContextError(err)
+	}
+	if d.requestBodyClosed.Load() || d.getError() != nil {
+		return 0, io.EOF
+	}
+	bytesWritten, _ := d.unaryBody.Write(data) // always nil error
+	d.stats.addSent(bytesWritten)
+	return bytesWritten, nil
+}
+
+// SetSendTimeout limits how long each Write may block. It must be called
+// before the first Write. Unary writes are buffered and never block, so it
+// has no effect on unary calls.
+func (d *duplexHTTPCall) SetSendTimeout(clock Clock, timeout time.Duration) {
+	if timeout <= 0 || d.isUnary() {
+		return
+	}
+	// net/http may have already consumed data from the pipe and be blocked on
+	// flow control, so closing the pipe alone doesn't abort the request. We
+	// need to be able to cancel it, too.
+	ctx, cancel := context.WithCancel(d.request.Context())
+	d.request = d.request.WithContext(ctx)
+	d.cancelRequest = cancel
+	d.sendWatchdog = &sendWatchdog{
+		clock:   clock,
+		timeout: timeout,
+		done:    ctx.Done(),
+		writes:  make(chan watchedWrite),
+		abort: func(err *Error) {
+			d.SetError(err)
+			_ = d.requestBodyWriter.CloseWithError(err)
+			cancel()
+		},
+	}
+}
+
+// SetReadLimit throttles reads from the response body to the given number of
+// bytes per second. Limits less than one disable throttling.
+func (d *duplexHTTPCall) SetReadLimit(clock Clock, bytesPerSecond int) {
+	if bytesPerSecond < 1 {
+		return
+	}
+	d.readLimiter = newReadLimiter(clock, bytesPerSecond)
+}
+
+// writeWithTimeout writes to the request body, enforcing the send timeout. A
+// blocked write can't be interrupted without closing the pipe, so a timeout
+// aborts the whole request.
+func (d *duplexHTTPCall) writeWithTimeout(data []byte) (int, error) {
+	if d.sendWatchdog == nil {
+		return d.requestBodyWriter.Write(data)
+	}
+	d.sendWatchdog.begin()
+	bytesWritten, err := d.requestBodyWriter.Write(data)
+	if timeoutErr := d.sendWatchdog.end(); timeoutErr != nil {
+		return bytesWritten, timeoutErr
+	}
+	return bytesWritten, err
+}
+
 // Close the request body. Callers *must* call CloseWrite before Read when
 // using HTTP/1.x.
 func (d *duplexHTTPCall) CloseWrite() error {
+	if d.isUnary() {
+		// Send the buffered request and wait for the response headers. Later
+		// calls are no-ops.
+		d.requestBodyClosed.Store(true)
+		d.sendRequestOnce.Do(d.makeUnaryRequest)
+		return nil
+	}
 	// Even if Write was never called, we need to make an HTTP request. This
 	// ensures that we've sent any headers to the server and that we have an HTTP
 	// response to read from.
@@ -130,9 +236,23 @@ func (d *duplexHTTPCall) CloseWrite() error {
 	// forever. To make sure users don't have to worry about this, the generated
 	// code for unary, client streaming, and server streaming RPCs must call
 	// CloseWrite automatically rather than requiring the user to do it.
+	d.requestBodyClosed.Store(true)
 	return d.requestBodyWriter.Close()
 }
 
+// SendErr reports, without blocking, whether Write is certain to fail. It
+// returns an error wrapping io.EOF if the request body has been closed,
+// either by us or by net/http after the server ended the stream.
+func (d *duplexHTTPCall) SendErr() error {
+	if err := d.ctx.Err(); err != nil {
+		return wrapIfContextError(err)
+	}
+	if d.requestBodyClosed.Load() || d.getError() != nil {
+		return io.EOF
+	}
+	return nil
+}
+
 // Header returns the HTTP request headers.
 func (d *duplexHTTPCall) Header() http.Header {
 	return d.request.Header
@@ -170,12 +290,41 @@ func (d *duplexHTTPCall) Read(data []byte) (int, error) {
 	if d.response == nil {
 		return 0, fmt.Errorf("nil response from %v", d.request.URL)
 	}
+	if d.readLimiter != nil && len(data) > 0 {
+		allowed, err := d.readLimiter.wait(d.ctx, len(data))
+		if err != nil {
+			d.SetError(err)
+			return 0, wrapIfContextError(err)
+		}
+		data = data[:allowed]
+	}
 	n, err := d.response.Body.Read(data)
-	return n, wrapIfRSTError(err)
+	if d.readLimiter != nil {
+		d.readLimiter.consume(n)
+	}
+	d.stats.addReceived(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		// If the context ends mid-read, net/http may report a transport-level
+		// error (like an HTTP/2 stream reset) rather than the context's error.
+		// Callers care about the context, so prefer its error.
+		if ctxErr := d.ctx.Err(); ctxErr != nil {
+			return n, wrapIfContextError(ctxErr)
+		}
+		return n, wrapIfConnectionClosedError(err)
+	}
+	return n, err
 }
 
 func (d *duplexHTTPCall) CloseRead() error {
+	if d.isUnary() {
+		// If the caller gives up before CloseWrite, don't send the request at
+		// all.
+		d.sendRequestOnce.Do(func() { close(d.responseReady) })
+	}
 	d.BlockUntilResponseReady()
+	if d.cancelRequest != nil {
+		defer d.cancelRequest()
+	}
 	if d.response == nil {
 		return nil
 	}
@@ -233,7 +382,9 @@ func (d *duplexHTTPCall) SetError(err error) {
 	//
 	// It's safe to ignore the returned error here. Under the hood, Close calls
 	// CloseWithError, which is documented to always return nil.
-	_ = d.requestBodyReader.Close()
+	if d.requestBodyReader != nil {
+		_ = d.requestBodyReader.Close()
+	}
 }
 
 // SetValidateResponse sets the response validation function. The function runs
@@ -252,6 +403,27 @@ func (d *duplexHTTPCall) ensureRequestMade() {
 	})
 }
 
+func (d *duplexHTTPCall) makeUnaryRequest() {
+	if length := d.unaryBody.Len(); length > 0 {
+		// Setting the length lets net/http send a Content-Length header, and
+		// setting GetBody lets it retry on a fresh connection if needed.
+		body := newUnaryRequestBody(d.unaryBody.Bytes())
+		d.request.ContentLength = int64(length)
+		d.request.Body = body
+		d.request.GetBody = body.clone
+	}
+	if err := d.getError(); err != nil {
+		// We already failed, so don't bother sending anything.
+		close(d.responseReady)
+		return
+	}
+	d.makeRequest()
+}
+
+func (d *duplexHTTPCall) isUnary() bool {
+	return d.streamType == StreamTypeUnary
+}
+
 func (d *duplexHTTPCall) makeRequest() {
 	// This runs concurrently with Write and CloseWrite. Read and CloseRead wait
 	// on d.responseReady, so we can't race with them.
@@ -269,14 +441,7 @@ func (d *duplexHTTPCall) makeRequest() {
 	// establish the receive side of the stream.
 	response, err := d.httpClient.Do(d.request) //nolint:bodyclose
 	if err != nil {
-		err = wrapIfContextError(err)
-		err = wrapIfLikelyH2CNotConfiguredError(d.request, err)
-		err = wrapIfLikelyWithGRPCNotUsedError(err)
-		err = wrapIfRSTError(err)
-		if _, ok := asError(err); !ok {
-			err = NewError(CodeUnavailable, err)
-		}
-		d.SetError(err)
+		d.SetError(d.wrapTransportError(err))
 		return
 	}
 	d.response = response
@@ -297,6 +462,27 @@ func (d *duplexHTTPCall) makeRequest() {
 	}
 }
 
+// wrapTransportError converts an error from the HTTP client into an *Error,
+// using the configured transportErrorCode if there is one.
+func (d *duplexHTTPCall) wrapTransportError(err error) error {
+	if _, ok := asError(err); ok {
+		return err
+	}
+	original := err
+	err = wrapIfContextError(err)
+	err = wrapIfLikelyH2CNotConfiguredError(d.request, err)
+	err = wrapIfLikelyWithGRPCNotUsedError(err)
+	err = wrapIfRSTError(err)
+	connectErr, ok := asError(err)
+	if !ok {
+		connectErr = NewError(CodeUnavailable, err)
+	}
+	if d.transportErrorCode != nil {
+		connectErr.code = d.transportErrorCode(original)
+	}
+	return connectErr
+}
+
 func (d *duplexHTTPCall) getError() error {
 	d.errMu.Lock()
 	defer d.errMu.Unlock()
@@ -316,3 +502,151 @@ func cloneURL(oldURL *url.URL) *url.URL {
 	}
 	return newURL
 }
+
+// requestBody is the read side of the request body pipe, as seen by net/http.
+// It records when net/http closes it, which it does once the server has
+// finished with the request.
+type requestBody struct {
+	*io.PipeReader
+
+	closed *atomic.Bool
+}
+
+func (b *requestBody) Close() error {
+	b.closed.Store(true)
+	return b.PipeReader.Close()
+}
+
+// unaryRequestBody is the buffered request body of a unary call.
+type unaryRequestBody struct {
+	bytes.Reader
+
+	data []byte
+}
+
+func newUnaryRequestBody(data []byte) *unaryRequestBody {
+	body := &unaryRequestBody{data: data}
+	body.Reset(data)
+	return body
+}
+
+func (b *unaryRequestBody) Close() error {
+	return nil
+}
+
+// clone is the request's GetBody, which net/http uses to retry requests.
+func (b *unaryRequestBody) clone() (io.ReadCloser, error) {
+	return newUnaryRequestBody(b.data), nil
+}
+
+// sendState lets the user-facing client stream types check whether they can
+// still send. Like streamStats, it's part of the RPC's rpcState, so
+// interceptors wrapping the connection don't hide it.
+//
+// A nil *sendState is valid and never reports an error.
+type sendState struct {
+	call atomic.Pointer[duplexHTTPCall]
+}
+
+func sendStateFromContext(ctx context.Context) *sendState {
+	if state := rpcStateFromContext(ctx); state != nil {
+		return &state.send
+	}
+	return nil
+}
+
+func (s *sendState) track(call *duplexHTTPCall) {
+	if s != nil {
+		s.call.Store(call)
+	}
+}
+
+func (s *sendState) err() error {
+	if s == nil {
+		return nil
+	}
+	if call := s.call.Load(); call != nil {
+		return call.SendErr()
+	}
+	return nil
+}
+
+// sendWatchdog aborts a stream's request if a single write blocks for longer
+// than the timeout. One goroutine, started by the first write, watches all of
+// the stream's writes. Each write still gets its own timer, since Clock timers
+// can't be reset, but timers that fire after their write finished are
+// ignored: only a write that's still blocked aborts the request.
+type sendWatchdog struct {
+	clock     Clock
+	timeout   time.Duration
+	done      <-chan struct{} // closed when the request ends
+	abort     func(*Error)
+	startOnce sync.Once
+	writes    chan watchedWrite
+
+	mu       sync.Mutex
+	seq      uint64 // identifies the latest write
+	inFlight bool
+	timer    Timer // the latest write's timer
+	err      *Error
+}
+
+type watchedWrite struct {
+	seq   uint64
+	timer Timer
+}
+
+// begin starts watching a write.
+func (w *sendWatchdog) begin() {
+	w.startOnce.Do(func() { go w.watch() })
+	timer := w.clock.NewTimer(w.timeout)
+	w.mu.Lock()
+	w.seq++
+	seq := w.seq
+	w.inFlight = true
+	w.timer = timer
+	w.mu.Unlock()
+	select {
+	case w.writes <- watchedWrite{seq: seq, timer: timer}:
+	case <-w.done:
+	}
+}
+
+// end stops watching the current write. It returns the timeout error if the
+// watchdog aborted the request.
+func (w *sendWatchdog) end() *Error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight = false
+	w.timer.Stop()
+	return w.err
+}
+
+func (w *sendWatchdog) watch() {
+	var current watchedWrite
+	var fired <-chan time.Time
+	for {
+		select {
+		case current = <-w.writes:
+			fired = current.timer.C()
+		case <-fired:
+			fired = nil
+			w.expire(current.seq)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// expire aborts the request if the given write is still blocked.
+func (w *sendWatchdog) expire(seq uint64) {
+	w.mu.Lock()
+	if !w.inFlight || w.seq != seq || w.err != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.err = errorf(CodeDeadlineExceeded, "send blocked for more than %v", w.timeout)
+	err := w.err
+	w.mu.Unlock()
+	w.abort(err)
+}
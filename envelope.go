@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -25,6 +26,36 @@ import (
 // same meaning in the gRPC-Web, gRPC-HTTP2, and Connect protocols.
 const flagEnvelopeCompressed = 0b00000001
 
+// envelopeKnownFlags is every flag used by the Connect, gRPC, and gRPC-Web
+// protocols. Prefixes with any other bits set aren't envelopes at all.
+const envelopeKnownFlags = flagEnvelopeCompressed | connectFlagEnvelopeEndStream | grpcFlagEnvelopeTrailer
+
+// ErrFramingDesync reports that a stream's framing is corrupt: the reader
+// found bytes that can't be the start of an envelope, so it can no longer
+// tell where messages begin and end. It distinguishes protocol-level
+// corruption from application errors. Errors that wrap it have
+// [CodeInternal], and once a stream reports one, every later Receive returns
+// the same error.
+var ErrFramingDesync = errors.New("framing desync")
+
+// framingDesyncError keeps the message of the underlying error while
+// matching ErrFramingDesync.
+type framingDesyncError struct {
+	err error
+}
+
+func (e *framingDesyncError) Error() string {
+	return e.err.Error()
+}
+
+func (e *framingDesyncError) Unwrap() error {
+	return e.err
+}
+
+func (e *framingDesyncError) Is(target error) bool {
+	return target == ErrFramingDesync
+}
+
 var errSpecialEnvelope = errorf(
 	CodeUnknown,
 	"final message has protocol-specific flags: %w",
@@ -48,6 +79,14 @@ func (e *envelope) IsSet(flag uint8) bool {
 	return e.Flags&flag == flag
 }
 
+// frameHook rewrites an envelope's flags and payload as it crosses the wire.
+// It's applied to each frame after compression on the way out and before
+// decompression on the way in, so it sees exactly the bytes on the wire.
+// Hooks exist to test handling of corrupt frames (flipped flags, truncated
+// payloads, and the like); they're deliberately unexported. A hook may
+// return the payload it was given.
+type frameHook func(flags uint8, payload []byte) (uint8, []byte)
+
 type envelopeWriter struct {
 	writer           io.Writer
 	codec            Codec
@@ -55,6 +94,12 @@ type envelopeWriter struct {
 	compressionPool  *compressionPool
 	bufferPool       *bufferPool
 	sendMaxBytes     int
+	stats            *streamStats
+	sendFrameHook    frameHook // nil outside of tests
+	// Scratch space for envelope prefixes. Writers aren't safe for concurrent
+	// use, and a local array would escape to the heap when passed to
+	// io.Writer.
+	prefix [5]byte
 }
 
 func (w *envelopeWriter) Marshal(message any) *Error {
@@ -82,8 +127,12 @@ func (w *envelopeWriter) Write(env *envelope) *Error {
 		if w.sendMaxBytes > 0 && env.Data.Len() > w.sendMaxBytes {
 			return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", env.Data.Len(), w.sendMaxBytes)
 		}
+		if env.Flags == 0 {
+			w.stats.addMessageSent(env.Data.Len(), env.Data.Len())
+		}
 		return w.write(env)
 	}
+	uncompressedSize := env.Data.Len()
 	data := w.bufferPool.Get()
 	defer w.bufferPool.Put(data)
 	if err := w.compressionPool.Compress(data, env.Data); err != nil {
@@ -92,6 +141,9 @@ func (w *envelopeWriter) Write(env *envelope) *Error {
 	if w.sendMaxBytes > 0 && data.Len() > w.sendMaxBytes {
 		return errorf(CodeResourceExhausted, "compressed message size %d exceeds sendMaxBytes %d", data.Len(), w.sendMaxBytes)
 	}
+	if env.Flags == 0 {
+		w.stats.addMessageSent(uncompressedSize, data.Len())
+	}
 	return w.write(&envelope{
 		Data:  data,
 		Flags: env.Flags | flagEnvelopeCompressed,
@@ -137,31 +189,47 @@ func (w *envelopeWriter) marshal(message any) *Error {
 }
 
 func (w *envelopeWriter) write(env *envelope) *Error {
-	prefix := [5]byte{}
-	prefix[0] = env.Flags
-	binary.BigEndian.PutUint32(prefix[1:5], uint32(env.Data.Len()))
-	if _, err := w.writer.Write(prefix[:]); err != nil {
+	if w.sendFrameHook != nil {
+		flags, payload := w.sendFrameHook(env.Flags, env.Data.Bytes())
+		env = &envelope{Data: bytes.NewBuffer(payload), Flags: flags}
+	}
+	w.prefix[0] = env.Flags
+	binary.BigEndian.PutUint32(w.prefix[1:5], uint32(env.Data.Len()))
+	if _, err := w.writer.Write(w.prefix[:]); err != nil {
 		if connectErr, ok := asError(err); ok {
 			return connectErr
 		}
 		return errorf(CodeUnknown, "write envelope: %w", err)
 	}
 	if _, err := io.Copy(w.writer, env.Data); err != nil {
+		if connectErr, ok := asError(err); ok {
+			return connectErr
+		}
 		return errorf(CodeUnknown, "write message: %w", err)
 	}
 	return nil
 }
 
 type envelopeReader struct {
-	reader          io.Reader
-	codec           Codec
-	last            envelope
-	compressionPool *compressionPool
-	bufferPool      *bufferPool
-	readMaxBytes    int
+	reader           io.Reader
+	codec            Codec
+	last             envelope
+	compressionPool  *compressionPool
+	bufferPool       *bufferPool
+	readMaxBytes     int
+	readMaxStream    int   // cumulative limit for all messages, streaming RPCs only
+	bytesRead        int64 // cumulative size of all messages
+	stats            *streamStats
+	receiveFrameHook frameHook // nil outside of tests
+	// Once the framing is corrupt, the stream is unusable: reads return
+	// desyncErr rather than interpreting arbitrary bytes as envelopes.
+	desyncErr *Error
 }
 
 func (r *envelopeReader) Unmarshal(message any) *Error {
+	if r.desyncErr != nil {
+		return r.desyncErr
+	}
 	buffer := r.bufferPool.Get()
 	defer r.bufferPool.Put(buffer)
 
@@ -180,9 +248,12 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 	case err != nil:
 		// Something's wrong.
 		return err
+	case env.Flags&^envelopeKnownFlags != 0:
+		return r.desync("protocol error: invalid envelope flags %08b", env.Flags)
 	}
 
 	data := env.Data
+	wireSize := data.Len()
 	if data.Len() > 0 && env.IsSet(flagEnvelopeCompressed) {
 		if r.compressionPool == nil {
 			return errorf(
@@ -203,7 +274,7 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		if n, err := discard(r.reader); err != nil {
 			return errorf(CodeInternal, "corrupt response: I/O error after end-stream message: %w", err)
 		} else if n > 0 {
-			return errorf(CodeInternal, "corrupt response: %d extra bytes after end of stream", n)
+			return r.desync("corrupt response: %d extra bytes after end of stream", n)
 		}
 		// One of the protocol-specific flags are set, so this is the end of the
 		// stream. Save the message for protocol-specific code to process and
@@ -218,12 +289,32 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		return errSpecialEnvelope
 	}
 
+	r.stats.addMessageReceived(data.Len(), wireSize)
+	if r.readMaxStream > 0 {
+		r.bytesRead += int64(data.Len())
+		if r.bytesRead > int64(r.readMaxStream) {
+			return errorf(
+				CodeResourceExhausted,
+				"stream size %d is larger than configured max %d",
+				r.bytesRead,
+				r.readMaxStream,
+			)
+		}
+	}
+
 	if err := r.codec.Unmarshal(data.Bytes(), message); err != nil {
 		return errorf(CodeInvalidArgument, "unmarshal into %T: %w", message, err)
 	}
 	return nil
 }
 
+// desync marks the stream's framing as corrupt and returns an error wrapping
+// ErrFramingDesync.
+func (r *envelopeReader) desync(template string, args ...any) *Error {
+	r.desyncErr = NewError(CodeInternal, &framingDesyncError{err: fmt.Errorf(template, args...)})
+	return r.desyncErr
+}
+
 func (r *envelopeReader) Read(env *envelope) *Error {
 	prefixes := [5]byte{}
 	prefixBytesRead, err := r.reader.Read(prefixes[:])
@@ -234,6 +325,7 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 		isSizeZeroPrefix(prefixes):
 		// Successfully read prefix and expect no additional data.
 		env.Flags = prefixes[0]
+		r.interceptFrame(env)
 		return nil
 	case err != nil && errors.Is(err, io.EOF) && prefixBytesRead == 0:
 		// The stream ended cleanly. That's expected, but we need to propagate them
@@ -281,6 +373,9 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 					// We're reading from an http.MaxBytesHandler, and we've exceeded the read limit.
 					return maxBytesErr
 				}
+				if connectErr, ok := asError(err); ok {
+					return connectErr
+				}
 				return errorf(CodeUnknown, "read enveloped message: %w", err)
 			}
 			if errors.Is(err, io.EOF) && bytesRead == 0 {
@@ -297,9 +392,22 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 		}
 	}
 	env.Flags = prefixes[0]
+	r.interceptFrame(env)
 	return nil
 }
 
+func (r *envelopeReader) interceptFrame(env *envelope) {
+	if r.receiveFrameHook == nil {
+		return
+	}
+	flags, payload := r.receiveFrameHook(env.Flags, env.Data.Bytes())
+	env.Flags = flags
+	// The payload may alias the buffer, but Write copies with memmove
+	// semantics.
+	env.Data.Reset()
+	env.Data.Write(payload)
+}
+
 func isSizeZeroPrefix(prefix [5]byte) bool {
 	for i := 1; i < 5; i++ {
 		if prefix[i] != 0 {
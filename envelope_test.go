@@ -0,0 +1,136 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+)
+
+func TestEnvelopeFrameHooks(t *testing.T) {
+	t.Parallel()
+	roundTrip := func(t *testing.T, send, receive frameHook) (*pingv1.PingRequest, *Error) {
+		t.Helper()
+		wire := &bytes.Buffer{}
+		writer := envelopeWriter{
+			writer:        wire,
+			codec:         &protoBinaryCodec{},
+			bufferPool:    newBufferPool(),
+			sendFrameHook: send,
+		}
+		assert.Nil(t, writer.Marshal(&pingv1.PingRequest{Number: 42, Text: "hello"}))
+		reader := envelopeReader{
+			reader:           wire,
+			codec:            &protoBinaryCodec{},
+			bufferPool:       newBufferPool(),
+			receiveFrameHook: receive,
+		}
+		var got pingv1.PingRequest
+		return &got, reader.Unmarshal(&got)
+	}
+	t.Run("passthrough", func(t *testing.T) {
+		t.Parallel()
+		identity := func(flags uint8, payload []byte) (uint8, []byte) { return flags, payload }
+		got, err := roundTrip(t, identity, identity)
+		assert.Nil(t, err)
+		assert.Equal(t, got.GetNumber(), int64(42))
+		assert.Equal(t, got.GetText(), "hello")
+	})
+	t.Run("flip_compressed_flag", func(t *testing.T) {
+		t.Parallel()
+		_, err := roundTrip(t, func(flags uint8, payload []byte) (uint8, []byte) {
+			return flags | flagEnvelopeCompressed, payload
+		}, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Code(), CodeInvalidArgument)
+	})
+	t.Run("truncate_payload", func(t *testing.T) {
+		t.Parallel()
+		_, err := roundTrip(t, nil, func(flags uint8, payload []byte) (uint8, []byte) {
+			return flags, payload[:len(payload)-1]
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Code(), CodeInvalidArgument)
+	})
+	t.Run("empty_frame", func(t *testing.T) {
+		t.Parallel()
+		// Hooks see zero-length frames too, so they can inject data into them.
+		wire := bytes.NewBuffer([]byte{0, 0, 0, 0, 0})
+		reader := envelopeReader{
+			reader:     wire,
+			codec:      &protoBinaryCodec{},
+			bufferPool: newBufferPool(),
+			receiveFrameHook: func(flags uint8, _ []byte) (uint8, []byte) {
+				return flags, []byte{0x08, 0x07} // number: 7
+			},
+		}
+		var got pingv1.PingRequest
+		assert.Nil(t, reader.Unmarshal(&got))
+		assert.Equal(t, got.GetNumber(), int64(7))
+	})
+}
+
+func BenchmarkEnvelopeWriterIdentity(b *testing.B) {
+	// Uncompressed messages are marshaled into a pooled buffer and written
+	// after their prefix without further copies, so a stream of small
+	// messages shouldn't allocate per message.
+	writer := envelopeWriter{
+		writer:     io.Discard,
+		codec:      &protoBinaryCodec{},
+		bufferPool: newBufferPool(),
+	}
+	message := &pingv1.PingRequest{Number: 42, Text: "hello"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := writer.Marshal(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEnvelopeReaderFramingDesync(t *testing.T) {
+	t.Parallel()
+	valid := []byte{0, 0, 0, 0, 2, 0x08, 0x07} // number: 7
+	wire := &bytes.Buffer{}
+	wire.Write(valid)
+	// A prefix with flags that no protocol uses, followed by what would be
+	// another valid message if the reader kept going.
+	wire.Write([]byte{0b01000000, 0, 0, 0, 0})
+	wire.Write(valid)
+	reader := envelopeReader{
+		reader:     wire,
+		codec:      &protoBinaryCodec{},
+		bufferPool: newBufferPool(),
+	}
+	var got pingv1.PingRequest
+	assert.Nil(t, reader.Unmarshal(&got))
+	assert.Equal(t, got.GetNumber(), int64(7))
+
+	err := reader.Unmarshal(&got)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeInternal)
+	assert.True(t, errors.Is(err, ErrFramingDesync))
+	assert.False(t, errors.Is(err, io.EOF))
+
+	// The stream stays unusable.
+	assert.True(t, reader.Unmarshal(&got) == err)
+	assert.Equal(t, wire.Len(), len(valid))
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -119,6 +120,11 @@ type Error struct {
 	details []*ErrorDetail
 	meta    http.Header
 	wireErr bool
+	// Never sent over the network.
+	internalCause error
+	// Set when the server provably didn't process the request, so it's safe
+	// to retry regardless of idempotency.
+	transparentRetry bool
 }
 
 // NewError annotates any Go error with a status code.
@@ -199,6 +205,24 @@ func (e *Error) Unwrap() error {
 	return e.err
 }
 
+// WithInternalCause attaches an error explaining the failure to server-side
+// code, like interceptors that log errors. Unlike the underlying error, the
+// internal cause is never sent to clients, so it's a safe place for details
+// that public APIs shouldn't leak. It returns the receiver to allow chaining.
+//
+// The internal cause isn't visible to [errors.Is] or [errors.As]; use
+// [Error.InternalCause] to retrieve it.
+func (e *Error) WithInternalCause(cause error) *Error {
+	e.internalCause = cause
+	return e
+}
+
+// InternalCause returns the error attached with [Error.WithInternalCause], if
+// any.
+func (e *Error) InternalCause() error {
+	return e.internalCause
+}
+
 // Code returns the error's status code.
 func (e *Error) Code() Code {
 	return e.code
@@ -248,6 +272,23 @@ func IsNotModifiedError(err error) bool {
 	return errors.Is(err, errNotModified)
 }
 
+// AsErrorOrContext finds the first [*Error] in err's chain, like [errors.As].
+// If there isn't one but err wraps [context.Canceled] or
+// [context.DeadlineExceeded], it returns a new *Error with [CodeCanceled] or
+// [CodeDeadlineExceeded] that wraps err. This gives callers a single path for
+// extracting codes from the errors returned by streams, which may come from
+// either the server or the local context. For any other error, it returns nil
+// and false.
+func AsErrorOrContext(err error) (*Error, bool) {
+	if connectErr, ok := asError(err); ok {
+		return connectErr, true
+	}
+	if connectErr, ok := asError(wrapIfContextError(err)); ok {
+		return connectErr, true
+	}
+	return nil, false
+}
+
 // errorf calls fmt.Errorf with the supplied template and arguments, then wraps
 // the resulting error.
 func errorf(c Code, template string, args ...any) *Error {
@@ -276,6 +317,24 @@ func wrapIfUncoded(err error) error {
 	return NewError(CodeUnknown, maybeCodedErr)
 }
 
+// DefaultTransportErrorCode is the default mapping from errors returned by the
+// client's HTTP transport to Connect codes. It maps context cancellation and
+// deadlines to [CodeCanceled] and [CodeDeadlineExceeded], HTTP/2 RST_STREAM
+// errors to the codes specified by gRPC, and everything else to
+// [CodeUnavailable]. Errors that are already [*Error]s keep their code.
+//
+// Custom mappings installed with [WithTransportErrorCode] can fall back to
+// DefaultTransportErrorCode for errors they don't handle.
+func DefaultTransportErrorCode(err error) Code {
+	if connectErr, ok := asError(err); ok {
+		return connectErr.Code()
+	}
+	if connectErr, ok := asError(wrapIfRSTError(wrapIfContextError(err))); ok {
+		return connectErr.Code()
+	}
+	return CodeUnavailable
+}
+
 // wrapIfContextError applies CodeCanceled or CodeDeadlineExceeded to Go's
 // context.Canceled and context.DeadlineExceeded errors, but only if they
 // haven't already been wrapped.
@@ -389,7 +448,11 @@ func wrapIfRSTError(err error) error {
 		"SETTINGS_TIMEOUT", "FRAME_SIZE_ERROR", "COMPRESSION_ERROR", "CONNECT_ERROR":
 		return NewError(CodeInternal, err)
 	case "REFUSED_STREAM":
-		return NewError(CodeUnavailable, err)
+		// The server refused the stream before any application processing
+		// (RFC 9113 section 8.7), so the call is safe to retry.
+		connectErr := NewError(CodeUnavailable, err)
+		connectErr.transparentRetry = true
+		return connectErr
 	case "CANCEL":
 		return NewError(CodeCanceled, err)
 	case "ENHANCE_YOUR_CALM":
@@ -401,6 +464,31 @@ func wrapIfRSTError(err error) error {
 	}
 }
 
+// wrapIfConnectionClosedError applies CodeUnavailable to errors reading a
+// response body that ended abruptly, before the server finished the RPC. A
+// clean end of the body is an io.EOF, which callers handle separately: it
+// means the server finished sending, so missing trailers are a protocol
+// error. Anything else means the connection failed underneath us. HTTP/2
+// RST_STREAM errors keep the codes gRPC specifies for them.
+func wrapIfConnectionClosedError(err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	err = wrapIfRSTError(err)
+	if _, ok := asError(err); ok {
+		return err
+	}
+	return NewError(CodeUnavailable, fmt.Errorf("connection closed before trailers: %w", err))
+}
+
+// isTransparentlyRetryable reports whether the error proves that the server
+// never processed the request. Such calls may be retried even if they're not
+// idempotent.
+func isTransparentlyRetryable(err error) bool {
+	connectErr, ok := asError(err)
+	return ok && connectErr.transparentRetry
+}
+
 func asMaxBytesError(err error, tmpl string, args ...any) *Error {
 	var maxBytesErr *http.MaxBytesError
 	if ok := errors.As(err, &maxBytesErr); !ok {
@@ -0,0 +1,99 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+// The functions in this file are shorthand for constructing an [*Error] with a
+// particular [Code]. Each formats its arguments with [fmt.Errorf], so the %w
+// verb wraps an underlying error.
+
+// CanceledErrorf is shorthand for NewError(CodeCanceled, fmt.Errorf(template, args...)).
+func CanceledErrorf(template string, args ...any) *Error {
+	return errorf(CodeCanceled, template, args...)
+}
+
+// UnknownErrorf is shorthand for NewError(CodeUnknown, fmt.Errorf(template, args...)).
+func UnknownErrorf(template string, args ...any) *Error {
+	return errorf(CodeUnknown, template, args...)
+}
+
+// InvalidArgumentErrorf is shorthand for NewError(CodeInvalidArgument, fmt.Errorf(template, args...)).
+func InvalidArgumentErrorf(template string, args ...any) *Error {
+	return errorf(CodeInvalidArgument, template, args...)
+}
+
+// DeadlineExceededErrorf is shorthand for NewError(CodeDeadlineExceeded, fmt.Errorf(template, args...)).
+func DeadlineExceededErrorf(template string, args ...any) *Error {
+	return errorf(CodeDeadlineExceeded, template, args...)
+}
+
+// NotFoundErrorf is shorthand for NewError(CodeNotFound, fmt.Errorf(template, args...)).
+func NotFoundErrorf(template string, args ...any) *Error {
+	return errorf(CodeNotFound, template, args...)
+}
+
+// AlreadyExistsErrorf is shorthand for NewError(CodeAlreadyExists, fmt.Errorf(template, args...)).
+func AlreadyExistsErrorf(template string, args ...any) *Error {
+	return errorf(CodeAlreadyExists, template, args...)
+}
+
+// PermissionDeniedErrorf is shorthand for NewError(CodePermissionDenied, fmt.Errorf(template, args...)).
+func PermissionDeniedErrorf(template string, args ...any) *Error {
+	return errorf(CodePermissionDenied, template, args...)
+}
+
+// ResourceExhaustedErrorf is shorthand for NewError(CodeResourceExhausted, fmt.Errorf(template, args...)).
+func ResourceExhaustedErrorf(template string, args ...any) *Error {
+	return errorf(CodeResourceExhausted, template, args...)
+}
+
+// FailedPreconditionErrorf is shorthand for NewError(CodeFailedPrecondition, fmt.Errorf(template, args...)).
+func FailedPreconditionErrorf(template string, args ...any) *Error {
+	return errorf(CodeFailedPrecondition, template, args...)
+}
+
+// AbortedErrorf is shorthand for NewError(CodeAborted, fmt.Errorf(template, args...)).
+func AbortedErrorf(template string, args ...any) *Error {
+	return errorf(CodeAborted, template, args...)
+}
+
+// OutOfRangeErrorf is shorthand for NewError(CodeOutOfRange, fmt.Errorf(template, args...)).
+func OutOfRangeErrorf(template string, args ...any) *Error {
+	return errorf(CodeOutOfRange, template, args...)
+}
+
+// UnimplementedErrorf is shorthand for NewError(CodeUnimplemented, fmt.Errorf(template, args...)).
+func UnimplementedErrorf(template string, args ...any) *Error {
+	return errorf(CodeUnimplemented, template, args...)
+}
+
+// InternalErrorf is shorthand for NewError(CodeInternal, fmt.Errorf(template, args...)).
+func InternalErrorf(template string, args ...any) *Error {
+	return errorf(CodeInternal, template, args...)
+}
+
+// UnavailableErrorf is shorthand for NewError(CodeUnavailable, fmt.Errorf(template, args...)).
+func UnavailableErrorf(template string, args ...any) *Error {
+	return errorf(CodeUnavailable, template, args...)
+}
+
+// DataLossErrorf is shorthand for NewError(CodeDataLoss, fmt.Errorf(template, args...)).
+func DataLossErrorf(template string, args ...any) *Error {
+	return errorf(CodeDataLoss, template, args...)
+}
+
+// UnauthenticatedErrorf is shorthand for NewError(CodeUnauthenticated, fmt.Errorf(template, args...)).
+func UnauthenticatedErrorf(template string, args ...any) *Error {
+	return errorf(CodeUnauthenticated, template, args...)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package connect
+
+import "log/slog"
+
+// LogValue implements [slog.LogValuer], so errors logged with log/slog become
+// structured groups with the code, message, and the types of any details,
+// which makes logs queryable by code:
+//
+//	logger.Error("rpc failed", "err", err)
+//	// level=ERROR msg="rpc failed" err.code=not_found err.message="no such user"
+//
+// The internal cause set with [Error.WithInternalCause] isn't included; log it
+// explicitly if you need it. Metadata isn't included either, since it often
+// carries credentials.
+func (e *Error) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, 3)
+	attrs = append(attrs, slog.String("code", e.Code().String()))
+	if message := e.Message(); message != "" {
+		attrs = append(attrs, slog.String("message", message))
+	}
+	if len(e.details) > 0 {
+		types := make([]string, len(e.details))
+		for i, detail := range e.details {
+			types[i] = detail.Type()
+		}
+		attrs = append(attrs, slog.Any("details", types))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,56 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package connect
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestErrorLogValue(t *testing.T) {
+	t.Parallel()
+	err := NewError(CodeNotFound, errors.New("no such user")).
+		WithInternalCause(errors.New("secret database error"))
+	detail, detailErr := NewErrorDetail(&emptypb.Empty{})
+	assert.Nil(t, detailErr)
+	err.AddDetail(detail)
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	logger.Error("rpc failed", "err", err)
+	assert.Equal(
+		t,
+		out.String(),
+		`level=ERROR msg="rpc failed" err.code=not_found err.message="no such user" err.details=[google.protobuf.Empty]`+"\n",
+	)
+
+	out.Reset()
+	logger.Info("done", "err", NewError(CodeCanceled, nil))
+	assert.Equal(t, out.String(), "level=INFO msg=done err.code=canceled\n")
+}
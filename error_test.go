@@ -15,8 +15,11 @@
 package connect
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -75,6 +78,20 @@ func TestCodeOf(t *testing.T) {
 		CodeUnavailable,
 	)
 	assert.Equal(t, CodeOf(errors.New("foo")), CodeUnknown)
+	assert.Equal(t, CodeOf(nil), CodeUnknown)
+	wrapped := fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", NewError(CodeNotFound, errors.New("foo"))))
+	assert.Equal(t, CodeOf(wrapped), CodeNotFound)
+
+	code, ok := LookupCode(wrapped)
+	assert.True(t, ok)
+	assert.Equal(t, code, CodeNotFound)
+	code, ok = LookupCode(NewError(CodeUnknown, errors.New("foo")))
+	assert.True(t, ok)
+	assert.Equal(t, code, CodeUnknown)
+	_, ok = LookupCode(errors.New("foo"))
+	assert.False(t, ok)
+	_, ok = LookupCode(nil)
+	assert.False(t, ok)
 }
 
 func TestErrorDetails(t *testing.T) {
@@ -107,3 +124,104 @@ func TestErrorIs(t *testing.T) {
 	assert.False(t, errors.Is(connectErr, NewError(CodeUnavailable, err)))
 	assert.True(t, errors.Is(connectErr, connectErr))
 }
+
+func TestErrorConstructors(t *testing.T) {
+	t.Parallel()
+	constructors := map[Code]func(string, ...any) *Error{
+		CodeCanceled:           CanceledErrorf,
+		CodeUnknown:            UnknownErrorf,
+		CodeInvalidArgument:    InvalidArgumentErrorf,
+		CodeDeadlineExceeded:   DeadlineExceededErrorf,
+		CodeNotFound:           NotFoundErrorf,
+		CodeAlreadyExists:      AlreadyExistsErrorf,
+		CodePermissionDenied:   PermissionDeniedErrorf,
+		CodeResourceExhausted:  ResourceExhaustedErrorf,
+		CodeFailedPrecondition: FailedPreconditionErrorf,
+		CodeAborted:            AbortedErrorf,
+		CodeOutOfRange:         OutOfRangeErrorf,
+		CodeUnimplemented:      UnimplementedErrorf,
+		CodeInternal:           InternalErrorf,
+		CodeUnavailable:        UnavailableErrorf,
+		CodeDataLoss:           DataLossErrorf,
+		CodeUnauthenticated:    UnauthenticatedErrorf,
+	}
+	assert.Equal(t, len(constructors), int(maxCode-minCode+1))
+	cause := errors.New("cause")
+	for code, construct := range constructors {
+		got := construct("thing %d: %w", 42, cause)
+		want := errorf(code, "thing %d: %w", 42, cause)
+		assert.Equal(t, got.Code(), code)
+		assert.Equal(t, got.Error(), want.Error())
+		assert.ErrorIs(t, got, cause)
+		// Both forms must look identical on the wire.
+		assert.Equal(t, grpcStatusFromError(got), grpcStatusFromError(want))
+		assert.Equal(t, newConnectWireError(got), newConnectWireError(want))
+		roundTripped := newConnectWireError(got).asError()
+		assert.Equal(t, roundTripped.Code(), code)
+		assert.Equal(t, roundTripped.Message(), want.Message())
+	}
+}
+
+func TestErrorInternalCause(t *testing.T) {
+	t.Parallel()
+	cause := errors.New("connect to 10.0.0.1:5432: password authentication failed")
+	err := NewError(CodeUnavailable, errors.New("database unavailable")).WithInternalCause(cause)
+	assert.ErrorIs(t, err.InternalCause(), cause)
+	assert.Equal(t, err.Error(), "unavailable: database unavailable")
+	status := grpcStatusFromError(err)
+	assert.Equal(t, status.Message, "database unavailable")
+	wire := newConnectWireError(err)
+	assert.Equal(t, wire.Message, "database unavailable")
+	assert.Nil(t, wire.asError().InternalCause())
+}
+
+func TestRefusedStreamIsTransparentlyRetryable(t *testing.T) {
+	t.Parallel()
+	refused := &url.Error{
+		Op:  http.MethodPost,
+		URL: "https://example.com/connect.ping.v1.PingService/Ping",
+		Err: errors.New("stream error: stream ID 3; REFUSED_STREAM; received from peer"),
+	}
+	err := wrapIfRSTError(refused)
+	assert.Equal(t, CodeOf(err), CodeUnavailable)
+	assert.True(t, isTransparentlyRetryable(err))
+	assert.True(t, isTransparentlyRetryable(fmt.Errorf("wrapped: %w", err)))
+
+	err = wrapIfRSTError(errors.New("stream error: stream ID 3; INTERNAL_ERROR; received from peer"))
+	assert.Equal(t, CodeOf(err), CodeInternal)
+	assert.False(t, isTransparentlyRetryable(err))
+	assert.False(t, isTransparentlyRetryable(NewError(CodeUnavailable, errors.New("foo"))))
+	assert.False(t, isTransparentlyRetryable(nil))
+}
+
+func TestDefaultTransportErrorCode(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, DefaultTransportErrorCode(context.Canceled), CodeCanceled)
+	assert.Equal(t, DefaultTransportErrorCode(&url.Error{Err: context.DeadlineExceeded}), CodeDeadlineExceeded)
+	assert.Equal(t, DefaultTransportErrorCode(errors.New("stream error: stream ID 3; ENHANCE_YOUR_CALM; received from peer")), CodeResourceExhausted)
+	assert.Equal(t, DefaultTransportErrorCode(NewError(CodePermissionDenied, errors.New("foo"))), CodePermissionDenied)
+	assert.Equal(t, DefaultTransportErrorCode(errors.New("connection refused")), CodeUnavailable)
+}
+
+func TestAsErrorOrContext(t *testing.T) {
+	t.Parallel()
+	original := NewError(CodeNotFound, errors.New("foo"))
+	connectErr, ok := AsErrorOrContext(fmt.Errorf("wrapped: %w", original))
+	assert.True(t, ok)
+	assert.True(t, connectErr == original)
+
+	connectErr, ok = AsErrorOrContext(fmt.Errorf("receive: %w", context.Canceled))
+	assert.True(t, ok)
+	assert.Equal(t, connectErr.Code(), CodeCanceled)
+	assert.ErrorIs(t, connectErr, context.Canceled)
+
+	connectErr, ok = AsErrorOrContext(fmt.Errorf("receive: %w", context.DeadlineExceeded))
+	assert.True(t, ok)
+	assert.Equal(t, connectErr.Code(), CodeDeadlineExceeded)
+	assert.ErrorIs(t, connectErr, context.DeadlineExceeded)
+
+	_, ok = AsErrorOrContext(errors.New("foo"))
+	assert.False(t, ok)
+	_, ok = AsErrorOrContext(nil)
+	assert.False(t, ok)
+}
@@ -30,6 +30,8 @@ import (
 type ErrorWriter struct {
 	bufferPool                   *bufferPool
 	protobuf                     Codec
+	grpcMessageEscapes           string
+	errorHTTPStatus              func(Code) int
 	allContentTypes              map[string]struct{}
 	grpcContentTypes             map[string]struct{}
 	grpcWebContentTypes          map[string]struct{}
@@ -45,7 +47,9 @@ func NewErrorWriter(opts ...HandlerOption) *ErrorWriter {
 	config := newHandlerConfig("", StreamTypeUnary, opts)
 	writer := &ErrorWriter{
 		bufferPool:                   config.BufferPool,
-		protobuf:                     newReadOnlyCodecs(config.Codecs).Protobuf(),
+		protobuf:                     withStatusMarshalOptions(newReadOnlyCodecs(config.Codecs).Protobuf(), config.GRPCStatusMarshalOptions),
+		grpcMessageEscapes:           config.GRPCMessageEscapes,
+		errorHTTPStatus:              config.ErrorHTTPStatus,
 		allContentTypes:              make(map[string]struct{}),
 		grpcContentTypes:             make(map[string]struct{}),
 		grpcWebContentTypes:          make(map[string]struct{}),
@@ -72,10 +76,15 @@ func NewErrorWriter(opts ...HandlerOption) *ErrorWriter {
 	if config.HandleGRPCWeb {
 		writer.grpcWebContentTypes[grpcWebContentTypeDefault] = struct{}{}
 		writer.allContentTypes[grpcWebContentTypeDefault] = struct{}{}
+		writer.grpcWebContentTypes[grpcWebTextContentTypeDefault] = struct{}{}
+		writer.allContentTypes[grpcWebTextContentTypeDefault] = struct{}{}
 		for name := range config.Codecs {
 			ct := grpcContentTypeFromCodecName(true /* web */, name)
 			writer.grpcWebContentTypes[ct] = struct{}{}
 			writer.allContentTypes[ct] = struct{}{}
+			text := grpcWebTextContentTypePrefix + name
+			writer.grpcWebContentTypes[text] = struct{}{}
+			writer.allContentTypes[text] = struct{}{}
 		}
 	}
 	return writer
@@ -120,7 +129,7 @@ func (w *ErrorWriter) writeConnectUnary(response http.ResponseWriter, err error)
 	if connectErr, ok := asError(err); ok {
 		mergeHeaders(response.Header(), connectErr.meta)
 	}
-	response.WriteHeader(connectCodeToHTTP(CodeOf(err)))
+	response.WriteHeader(connectErrorHTTPStatus(w.errorHTTPStatus, CodeOf(err)))
 	data, marshalErr := json.Marshal(newConnectWireError(err))
 	if marshalErr != nil {
 		return fmt.Errorf("marshal error: %w", marshalErr)
@@ -146,7 +155,7 @@ func (w *ErrorWriter) writeConnectStreaming(response http.ResponseWriter, err er
 
 func (w *ErrorWriter) writeGRPC(response http.ResponseWriter, err error) error {
 	trailers := make(http.Header, 2) // need space for at least code & message
-	grpcErrorToTrailer(trailers, w.protobuf, err)
+	grpcErrorToTrailer(trailers, w.protobuf, err, w.grpcMessageEscapes)
 	// To make net/http reliably send trailers without a body, we must set the
 	// Trailers header rather than using http.TrailerPrefix. See
 	// https://github.com/golang/go/issues/54723.
@@ -163,7 +172,7 @@ func (w *ErrorWriter) writeGRPC(response http.ResponseWriter, err error) error {
 func (w *ErrorWriter) writeGRPCWeb(response http.ResponseWriter, err error) error {
 	// This is a trailers-only response. To match the behavior of Envoy and
 	// protocol_grpc.go, put the trailers in the HTTP headers.
-	grpcErrorToTrailer(response.Header(), w.protobuf, err)
+	grpcErrorToTrailer(response.Header(), w.protobuf, err, w.grpcMessageEscapes)
 	response.WriteHeader(http.StatusOK)
 	return nil
 }
@@ -0,0 +1,129 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// firstMessageDeadlineConn fails the RPC with CodeDeadlineExceeded if the
+// client doesn't deliver a complete first message in time. The timer starts
+// on the first call to Receive and runs on the handler's Clock. If it fires,
+// a pending read is interrupted by moving the read deadline to the present
+// where the http.ResponseWriter supports read deadlines, and by closing the
+// request body elsewhere, which interrupts HTTP/2 reads but not HTTP/1. If the
+// first message arrives in time, the read deadline is never touched, so any
+// deadline set by the server (for example, from http.Server.ReadTimeout)
+// stays in effect.
+type firstMessageDeadlineConn struct {
+	handlerConnCloser
+
+	timeout        time.Duration
+	clock          Clock
+	responseWriter http.ResponseWriter
+	request        *http.Request
+	started        bool // only accessed by Receive
+
+	mu      sync.Mutex
+	stopped bool
+	expired bool
+	stop    chan struct{}
+}
+
+func newFirstMessageDeadlineConn(
+	conn handlerConnCloser,
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	timeout time.Duration,
+	clock Clock,
+) *firstMessageDeadlineConn {
+	return &firstMessageDeadlineConn{
+		handlerConnCloser: conn,
+		timeout:           timeout,
+		clock:             clock,
+		responseWriter:    responseWriter,
+		request:           request,
+		stop:              make(chan struct{}),
+	}
+}
+
+func (c *firstMessageDeadlineConn) Receive(msg any) error {
+	if c.started {
+		return c.handlerConnCloser.Receive(msg)
+	}
+	c.started = true
+	c.arm()
+	err := c.handlerConnCloser.Receive(msg)
+	if c.disarm() && !errors.Is(err, io.EOF) {
+		// Even if the message arrived just as the timer fired, the read
+		// deadline may already have moved, so later reads would fail.
+		return errorf(CodeDeadlineExceeded, "no request message received within %v", c.timeout)
+	}
+	return err
+}
+
+func (c *firstMessageDeadlineConn) Close(err error) error {
+	c.disarm()
+	return c.handlerConnCloser.Close(err)
+}
+
+func (c *firstMessageDeadlineConn) arm() {
+	timer := c.clock.NewTimer(c.timeout)
+	go func() {
+		select {
+		case <-timer.C():
+			c.expire()
+		case <-c.stop:
+			timer.Stop()
+		}
+	}()
+}
+
+// expire interrupts the pending read, unless the first message has already
+// arrived.
+func (c *firstMessageDeadlineConn) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.expired = true
+	if !setRequestReadDeadline(c.responseWriter, time.Now()) {
+		_ = c.request.Body.Close()
+	}
+}
+
+// disarm stops the timer once the first message arrives (or the RPC ends) and
+// reports whether it had already fired. Later messages aren't limited.
+func (c *firstMessageDeadlineConn) disarm() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+	return c.expired
+}
+
+func (c *firstMessageDeadlineConn) getHTTPMethod() string {
+	if methoder, ok := c.handlerConnCloser.(interface{ getHTTPMethod() string }); ok {
+		return methoder.getHTTPMethod()
+	}
+	return http.MethodPost
+}
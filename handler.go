@@ -18,6 +18,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // A Handler is the server-side implementation of a single RPC defined by a
@@ -27,11 +30,15 @@ import (
 // the binary Protobuf and JSON codecs. They support gzip compression using the
 // standard library's [compress/gzip].
 type Handler struct {
-	spec             Spec
-	implementation   StreamingHandlerFunc
-	protocolHandlers map[string][]protocolHandler // Method to protocol handlers
-	allowMethod      string                       // Allow header
-	acceptPost       string                       // Accept-Post header
+	spec                Spec
+	implementation      StreamingHandlerFunc
+	protocolHandlers    map[string][]protocolHandler // Method to protocol handlers
+	allowMethod         string                       // Allow header
+	acceptPost          string                       // Accept-Post header
+	maxHeaderBytes      int
+	clock               Clock
+	onFinish            func(RPCInfo)
+	firstMessageTimeout time.Duration
 }
 
 // NewUnaryHandler constructs a [Handler] for a request-response procedure.
@@ -89,11 +96,15 @@ func NewUnaryHandler[Req, Res any](
 
 	protocolHandlers := config.newProtocolHandlers()
 	return &Handler{
-		spec:             config.newSpec(),
-		implementation:   implementation,
-		protocolHandlers: mappedMethodHandlers(protocolHandlers),
-		allowMethod:      sortedAllowMethodValue(protocolHandlers),
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:                config.newSpec(),
+		implementation:      implementation,
+		protocolHandlers:    mappedMethodHandlers(protocolHandlers),
+		allowMethod:         sortedAllowMethodValue(protocolHandlers),
+		acceptPost:          sortedAcceptPostValue(protocolHandlers),
+		maxHeaderBytes:      config.MaxHeaderBytes,
+		clock:               config.Clock,
+		onFinish:            config.OnFinish,
+		firstMessageTimeout: config.FirstMessageTimeout,
 	}
 }
 
@@ -107,7 +118,7 @@ func NewClientStreamHandler[Req, Res any](
 		procedure,
 		StreamTypeClient,
 		func(ctx context.Context, conn StreamingHandlerConn) error {
-			stream := &ClientStream[Req]{conn: conn}
+			stream := &ClientStream[Req]{ctx: ctx, conn: conn, stats: streamStatsFromContext(ctx)}
 			res, err := implementation(ctx, stream)
 			if err != nil {
 				return err
@@ -148,7 +159,7 @@ func NewServerStreamHandler[Req, Res any](
 					header: conn.RequestHeader(),
 					method: http.MethodPost,
 				},
-				&ServerStream[Res]{conn: conn},
+				&ServerStream[Res]{ctx: ctx, conn: conn, stats: streamStatsFromContext(ctx)},
 			)
 		},
 		options...,
@@ -167,7 +178,12 @@ func NewBidiStreamHandler[Req, Res any](
 		func(ctx context.Context, conn StreamingHandlerConn) error {
 			return implementation(
 				ctx,
-				&BidiStream[Req, Res]{conn: conn},
+				&BidiStream[Req, Res]{
+					ctx:        ctx,
+					conn:       conn,
+					stats:      streamStatsFromContext(ctx),
+					requestEOF: requestEOFFromContext(ctx),
+				},
 			)
 		},
 		options...,
@@ -180,6 +196,7 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	// EOF: the stream we construct later on already does that, and we only
 	// return early when dealing with misbehaving clients. In those cases, it's
 	// okay if we can't re-use the connection.
+	start := h.clock.Now()
 	isBidi := (h.spec.StreamType & StreamTypeBidi) == StreamTypeBidi
 	if isBidi && request.ProtoMajor < 2 {
 		// Clients coded to expect full-duplex connections may hang if they've
@@ -187,6 +204,7 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		// underlying TCP connection.
 		responseWriter.Header().Set("Connection", "close")
 		responseWriter.WriteHeader(http.StatusHTTPVersionNotSupported)
+		h.finish(start, nil, errorf(CodeUnimplemented, "bidi streams require at least HTTP/2"))
 		return
 	}
 
@@ -194,6 +212,7 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if len(protocolHandlers) == 0 {
 		responseWriter.Header().Set("Allow", h.allowMethod)
 		responseWriter.WriteHeader(http.StatusMethodNotAllowed)
+		h.finish(start, nil, errorf(CodeUnimplemented, "HTTP method %s not allowed", request.Method))
 		return
 	}
 
@@ -210,6 +229,7 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if protocolHandler == nil {
 		responseWriter.Header().Set("Accept-Post", h.acceptPost)
 		responseWriter.WriteHeader(http.StatusUnsupportedMediaType)
+		h.finish(start, nil, errorf(CodeUnimplemented, "unsupported content type %q", contentType))
 		return
 	}
 
@@ -223,20 +243,47 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if cancel != nil {
 		defer cancel()
 	}
-	connCloser, ok := protocolHandler.NewConn(
-		responseWriter,
-		request.WithContext(ctx),
-	)
-	if !ok {
+	ctx, state := withRPCState(ctx)
+	state.metadata = &handlerMetadata{}
+	state.clock, state.start = h.clock, start
+	request = request.WithContext(ctx)
+	if h.spec.StreamType == StreamTypeBidi {
+		state.requestEOF = newReadAheadBody(request.Body)
+		request.Body = state.requestEOF
+	}
+	connCloser, err := protocolHandler.NewConn(responseWriter, request)
+	if err != nil {
 		// Failed to create stream, usually because client used an unknown
-		// compression algorithm. Nothing further to do.
+		// compression algorithm. The protocol has already responded.
+		h.finish(start, &state.stats, err)
 		return
 	}
-	if timeoutErr != nil {
-		_ = connCloser.Close(timeoutErr)
-		return
+	connCloser = &handlerMetadataConn{handlerConnCloser: connCloser, metadata: state.metadata}
+	if h.firstMessageTimeout > 0 {
+		connCloser = newFirstMessageDeadlineConn(connCloser, responseWriter, request, h.firstMessageTimeout, h.clock)
+	}
+	err = timeoutErr
+	if err == nil && h.maxHeaderBytes > 0 {
+		if size := headerBytes(request.Header); size > h.maxHeaderBytes {
+			err = errorf(
+				CodeResourceExhausted,
+				"request headers size %d exceeds configured max %d",
+				size, h.maxHeaderBytes,
+			)
+		}
+	}
+	if err == nil {
+		err = h.implementation(ctx, connCloser)
+	}
+	_ = connCloser.Close(err)
+	h.finish(start, &state.stats, err)
+}
+
+// finish reports the RPC to the OnFinish callback, if any.
+func (h *Handler) finish(start time.Time, stats *streamStats, err error) {
+	if h.onFinish != nil {
+		h.onFinish(newRPCInfo(h.spec, h.clock.Now().Sub(start), stats, err))
 	}
-	_ = connCloser.Close(h.implementation(ctx, connCloser))
 }
 
 type handlerConfig struct {
@@ -252,8 +299,18 @@ type handlerConfig struct {
 	IdempotencyLevel             IdempotencyLevel
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
+	ReadMaxStreamBytes           int
 	SendMaxBytes                 int
 	StreamType                   StreamType
+	Clock                        Clock
+	MaxHeaderBytes               int
+	DisableCompression           bool
+	GRPCMessageEscapes           string
+	GRPCStatusMarshalOptions     *proto.MarshalOptions
+	FlushBehavior                FlushBehavior
+	ErrorHTTPStatus              func(Code) int
+	OnFinish                     func(RPCInfo)
+	FirstMessageTimeout          time.Duration
 }
 
 func newHandlerConfig(procedure string, streamType StreamType, options []HandlerOption) *handlerConfig {
@@ -266,6 +323,7 @@ func newHandlerConfig(procedure string, streamType StreamType, options []Handler
 		HandleGRPCWeb:    true,
 		BufferPool:       newBufferPool(),
 		StreamType:       streamType,
+		Clock:            systemClock{},
 	}
 	withProtoBinaryCodec().applyToHandler(&config)
 	withProtoJSONCodecs().applyToHandler(&config)
@@ -273,6 +331,10 @@ func newHandlerConfig(procedure string, streamType StreamType, options []Handler
 	for _, opt := range options {
 		opt.applyToHandler(&config)
 	}
+	if config.DisableCompression {
+		config.CompressionPools = make(map[string]*compressionPool)
+		config.CompressionNames = []string{compressionIdentity}
+	}
 	return &config
 }
 
@@ -306,9 +368,15 @@ func (c *handlerConfig) newProtocolHandlers() []protocolHandler {
 			CompressMinBytes:             c.CompressMinBytes,
 			BufferPool:                   c.BufferPool,
 			ReadMaxBytes:                 c.ReadMaxBytes,
+			ReadMaxStreamBytes:           c.ReadMaxStreamBytes,
 			SendMaxBytes:                 c.SendMaxBytes,
 			RequireConnectProtocolHeader: c.RequireConnectProtocolHeader,
 			IdempotencyLevel:             c.IdempotencyLevel,
+			Clock:                        c.Clock,
+			GRPCMessageEscapes:           c.GRPCMessageEscapes,
+			GRPCStatusMarshalOptions:     c.GRPCStatusMarshalOptions,
+			FlushBehavior:                c.FlushBehavior,
+			ErrorHTTPStatus:              c.ErrorHTTPStatus,
 		}))
 	}
 	return handlers
@@ -326,10 +394,14 @@ func newStreamHandler(
 	}
 	protocolHandlers := config.newProtocolHandlers()
 	return &Handler{
-		spec:             config.newSpec(),
-		implementation:   implementation,
-		protocolHandlers: mappedMethodHandlers(protocolHandlers),
-		allowMethod:      sortedAllowMethodValue(protocolHandlers),
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:                config.newSpec(),
+		implementation:      implementation,
+		protocolHandlers:    mappedMethodHandlers(protocolHandlers),
+		allowMethod:         sortedAllowMethodValue(protocolHandlers),
+		acceptPost:          sortedAcceptPostValue(protocolHandlers),
+		maxHeaderBytes:      config.MaxHeaderBytes,
+		clock:               config.Clock,
+		onFinish:            config.OnFinish,
+		firstMessageTimeout: config.FirstMessageTimeout,
 	}
 }
@@ -17,19 +17,26 @@ package connect_test
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	connect "connectrpc.com/connect"
 	"connectrpc.com/connect/internal/assert"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
 	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	statusv1 "connectrpc.com/connect/internal/gen/connectext/grpc/status/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
@@ -147,6 +154,10 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			"application/grpc-web+json",
 			"application/grpc-web+json; charset=utf-8",
 			"application/grpc-web+proto",
+			"application/grpc-web-text",
+			"application/grpc-web-text+json",
+			"application/grpc-web-text+json; charset=utf-8",
+			"application/grpc-web-text+proto",
 			"application/json",
 			"application/json; charset=utf-8",
 			"application/proto",
@@ -254,6 +265,81 @@ func TestHandlerMaliciousPrefix(t *testing.T) {
 	wg.Wait()
 }
 
+func TestServerStreamReceiveAfterRequest(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			_ context.Context,
+			_ *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			// The request message has already been consumed, so there's nothing
+			// left to receive.
+			err := stream.Conn().Receive(&pingv1.CountUpRequest{})
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, stream.Conn().Spec().StreamType, connect.StreamTypeServer)
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb(), connect.WithProtoJSON()} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.False(t, stream.Receive())
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+	}
+}
+
+func TestUnaryContentLength(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	post := func(t *testing.T, procedure string, body []byte) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+procedure,
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		// Otherwise, net/http asks for gzip and transparently decompresses the
+		// response, discarding the Content-Length.
+		request.Header.Set("Accept-Encoding", "identity")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		// Large enough that net/http won't compute the length on its own.
+		text := strings.Repeat("a", 64*1024)
+		response := post(t, pingv1connect.PingServicePingProcedure, []byte(`{"text":"`+text+`"}`))
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Zero(t, response.TransferEncoding)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, response.ContentLength, int64(len(body)))
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		response := post(t, pingv1connect.PingServiceFailProcedure, []byte(`{"code":5}`))
+		assert.Equal(t, response.StatusCode, http.StatusNotFound)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, response.ContentLength, int64(len(body)))
+	})
+}
+
 type successPingServer struct {
 	pingv1connect.UnimplementedPingServiceHandler
 }
@@ -261,3 +347,659 @@ type successPingServer struct {
 func (successPingServer) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
 	return &connect.Response[pingv1.PingResponse]{}, nil
 }
+
+func TestHandlerMaxHeaderBytes(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithMaxHeaderBytes(1024),
+	))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("Small", "value")
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+
+		request = connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set("Large", strings.Repeat("a", 2048))
+		_, err = client.Ping(context.Background(), request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+		countUp := connect.NewRequest(&pingv1.CountUpRequest{Number: 1})
+		countUp.Header().Set("Large", strings.Repeat("a", 2048))
+		stream, err := client.CountUp(context.Background(), countUp)
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+		assert.Nil(t, stream.Close())
+	}
+}
+
+func TestHandlerOnFinishRejected(t *testing.T) {
+	t.Parallel()
+	var infos []connect.RPCInfo
+	_, handler := pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithOnFinish(func(info connect.RPCInfo) { infos = append(infos, info) }),
+	)
+	for _, testCase := range []struct {
+		name       string
+		method     string
+		procedure  string
+		header     http.Header
+		wantStatus int
+	}{
+		{
+			name:       "unsupported method",
+			method:     http.MethodPut,
+			procedure:  pingv1connect.PingServicePingProcedure,
+			header:     http.Header{"Content-Type": {"application/proto"}},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unsupported content type",
+			method:     http.MethodPost,
+			procedure:  pingv1connect.PingServicePingProcedure,
+			header:     http.Header{"Content-Type": {"text/plain"}},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "unknown compression",
+			method:     http.MethodPost,
+			procedure:  pingv1connect.PingServicePingProcedure,
+			header:     http.Header{"Content-Type": {"application/proto"}, "Content-Encoding": {"bogus"}},
+			wantStatus: http.StatusNotFound, // Connect reports CodeUnimplemented as a 404
+		},
+		{
+			name:       "bidi over HTTP/1",
+			method:     http.MethodPost,
+			procedure:  pingv1connect.PingServiceCumSumProcedure,
+			header:     http.Header{"Content-Type": {"application/connect+proto"}},
+			wantStatus: http.StatusHTTPVersionNotSupported,
+		},
+	} {
+		infos = nil
+		request := httptest.NewRequest(testCase.method, testCase.procedure, strings.NewReader(""))
+		request.Header = testCase.header
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, recorder.Code, testCase.wantStatus, assert.Sprintf("%s", testCase.name))
+		assert.Equal(t, len(infos), 1, assert.Sprintf("%s", testCase.name))
+		assert.Equal(t, infos[0].Spec.Procedure, testCase.procedure)
+		assert.Equal(t, infos[0].Code, connect.CodeUnimplemented, assert.Sprintf("%s", testCase.name))
+	}
+}
+
+func TestHandlerReceiveCleanEOF(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var count int64
+			for {
+				_, err := stream.Receive()
+				if err == io.EOF { //nolint:errorlint // Receive returns io.EOF itself
+					break
+				} else if err != nil {
+					return err
+				}
+				count++
+			}
+			return stream.Send(&pingv1.CumSumResponse{Sum: count})
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream := client.CumSum(context.Background())
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		}
+		assert.Nil(t, stream.CloseRequest())
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Sum, int64(3))
+		_, err = stream.Receive()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, stream.CloseResponse())
+	}
+}
+
+func TestHandlerSendAfterClientDisconnect(t *testing.T) {
+	t.Parallel()
+	sendErrs := make(chan error, 3)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			ctx context.Context,
+			_ *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			for i := int64(1); ; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					<-ctx.Done()
+					// Once the client is gone, Send fails without writing.
+					sendErrs <- stream.Send(&pingv1.CountUpResponse{Number: i})
+					return err
+				}
+			}
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		cancel()
+		_ = stream.Close()
+		select {
+		case err := <-sendErrs:
+			assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler didn't notice the client disconnecting")
+		}
+	}
+}
+
+func TestHandlerBidiSendClosed(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			// The handler notices the half-close without calling Receive, and
+			// the buffered messages are still there afterwards.
+			select {
+			case <-stream.SendClosed():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			var sum int64
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					return err
+				}
+				sum += request.Number
+			}
+			return stream.Send(&pingv1.CumSumResponse{Sum: sum})
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stream := client.CumSum(ctx)
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, stream.CloseRequest())
+		response, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Sum, int64(2))
+		assert.Nil(t, stream.CloseResponse())
+		cancel()
+	}
+}
+
+func TestHandlerFlushBehavior(t *testing.T) {
+	t.Parallel()
+	const messages = 10
+	run := func(t *testing.T, behavior connect.FlushBehavior) []int64 {
+		t.Helper()
+		var flushes atomic.Int64
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithFlushBehavior(behavior)))
+		server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mux.ServeHTTP(&flushCountingWriter{ResponseWriter: w, flushes: &flushes}, r)
+		}))
+		var counts []int64
+		for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+			flushes.Store(0)
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: messages}))
+			assert.Nil(t, err)
+			responses, err := stream.ReceiveAll(0)
+			assert.Nil(t, err)
+			assert.Equal(t, len(responses), messages)
+			counts = append(counts, flushes.Load())
+		}
+		return counts
+	}
+	t.Run("per_message", func(t *testing.T) {
+		t.Parallel()
+		for _, count := range run(t, connect.FlushPerMessage) {
+			assert.True(t, count >= messages, assert.Sprintf("%d flushes", count))
+		}
+	})
+	t.Run("on_close", func(t *testing.T) {
+		t.Parallel()
+		for _, count := range run(t, connect.FlushOnClose) {
+			assert.Equal(t, count, int64(1))
+		}
+	})
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		// Unary gRPC responses flush once, with the trailers, regardless of
+		// the configured behavior.
+		var flushes atomic.Int64
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		server := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mux.ServeHTTP(&flushCountingWriter{ResponseWriter: w, flushes: &flushes}, r)
+		}))
+		for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb()} {
+			flushes.Store(0)
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+			assert.Equal(t, flushes.Load(), int64(1))
+		}
+	})
+}
+
+type flushCountingWriter struct {
+	http.ResponseWriter
+
+	flushes *atomic.Int64
+}
+
+func (w *flushCountingWriter) Flush() {
+	w.flushes.Add(1)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func TestHandlerFirstMessageTimeout(t *testing.T) {
+	t.Parallel()
+	const timeout = 100 * time.Millisecond
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithFirstMessageTimeout(timeout)))
+	http1Server := httptest.NewServer(mux)
+	t.Cleanup(http1Server.Close)
+	http2Server := newHTTP2Server(t, mux)
+	for _, server := range []*httptest.Server{http1Server, http2Server} {
+		// A client that sends headers but never a message is cut off.
+		body, pipeWriter := io.Pipe()
+		t.Cleanup(func() { _ = pipeWriter.Close() })
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+pingv1connect.PingServiceSumProcedure,
+			body,
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/grpc")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		_, err = io.Copy(io.Discard, response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Equal(t, response.Trailer.Get("Grpc-Status"), strconv.Itoa(int(connect.CodeDeadlineExceeded)))
+
+		// Once the first message arrives, the client may take its time.
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		stream := client.Sum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+		time.Sleep(2 * timeout)
+		assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+		sum, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, sum.Msg.GetSum(), int64(3))
+	}
+
+	// Disarming the timeout leaves the server's own read deadline in place.
+	readTimeoutServer := httptest.NewUnstartedServer(mux)
+	readTimeoutServer.Config.ReadTimeout = 2 * timeout
+	readTimeoutServer.Start()
+	t.Cleanup(readTimeoutServer.Close)
+	client := pingv1connect.NewPingServiceClient(readTimeoutServer.Client(), readTimeoutServer.URL, connect.WithGRPC())
+	stream := client.Sum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+	time.Sleep(4 * timeout)
+	_ = stream.Send(&pingv1.SumRequest{Number: 2})
+	_, err := stream.CloseAndReceive()
+	assert.NotNil(t, err)
+}
+
+func TestHandlerTrailerFromContext(t *testing.T) {
+	t.Parallel()
+	// Code deep in a handler's call stack only has the context.
+	addTrailers := func(ctx context.Context) error {
+		if err := connect.AppendTrailer(ctx, "x-single", "one"); err != nil {
+			return err
+		}
+		return connect.SetTrailer(ctx, http.Header{"X-Multi": []string{"a", "b"}})
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if err := addTrailers(ctx); err != nil {
+				return nil, err
+			}
+			if request.Msg.GetNumber() < 0 {
+				return nil, connect.NewError(connect.CodeNotFound, errors.New("not found"))
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Trailer().Set("X-Direct", "yes")
+			return response, nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			// Trailers may be added after messages are sent.
+			return addTrailers(ctx)
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	checkTrailers := func(trailer http.Header) {
+		t.Helper()
+		assert.Equal(t, trailer.Values("X-Single"), []string{"one"})
+		assert.Equal(t, trailer.Values("X-Multi"), []string{"a", "b"})
+	}
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		checkTrailers(response.Trailer())
+		assert.Equal(t, response.Trailer().Get("X-Direct"), "yes")
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeNotFound)
+		checkTrailers(connectErr.Meta())
+
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		_, err = stream.ReceiveAll(0)
+		assert.Nil(t, err)
+		checkTrailers(stream.ResponseTrailer())
+	}
+	// Outside of a handler, there's nowhere to put trailers.
+	assert.NotNil(t, connect.AppendTrailer(context.Background(), "x-single", "one"))
+}
+
+func TestHandlerHeaderFromContext(t *testing.T) {
+	t.Parallel()
+	lateErrs := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if err := connect.SetHeader(ctx, http.Header{"x-multi": []string{"a", "b"}}); err != nil {
+				return nil, err
+			}
+			if request.Msg.GetNumber() < 0 {
+				return nil, connect.NewError(connect.CodeNotFound, errors.New("not found"))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			if err := connect.SetHeader(ctx, http.Header{"X-Multi": []string{"a", "b"}}); err != nil {
+				return err
+			}
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			// The headers went out with the first message.
+			lateErrs <- connect.SetHeader(ctx, http.Header{"X-Late": []string{"too late"}})
+			return nil
+		},
+	}))
+	server := newHTTP2Server(t, mux)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Values("X-Multi"), []string{"a", "b"})
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeNotFound)
+		assert.Equal(t, connectErr.Meta().Values("X-Multi"), []string{"a", "b"})
+
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		_, err = stream.ReceiveAll(0)
+		assert.Nil(t, err)
+		assert.Equal(t, stream.ResponseHeader().Values("X-Multi"), []string{"a", "b"})
+		assert.Zero(t, stream.ResponseHeader().Get("X-Late"))
+		assert.NotNil(t, <-lateErrs)
+	}
+	assert.NotNil(t, connect.SetHeader(context.Background(), http.Header{"X-Multi": []string{"a"}}))
+}
+
+func TestHandlerGRPCMessageEscapes(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				return nil, connect.NewError(connect.CodeInternal, errors.New("oh no: 100%"))
+			},
+		},
+		connect.WithGRPCMessageEscapes(" :"),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		server.URL+pingv1connect.PingServicePingProcedure,
+		bytes.NewReader([]byte{0, 0, 0, 0, 0}),
+	)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/grpc-web+proto")
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = response.Body.Close() })
+	// Trailers-only gRPC-Web responses carry the status in the headers.
+	assert.Equal(t, response.Header.Get("Grpc-Message"), "oh%20no%3A%20100%25")
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPCWeb())
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	var connectErr *connect.Error
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, connectErr.Message(), "oh no: 100%")
+}
+
+func TestHandlerErrorHTTPStatus(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithErrorHTTPStatus(func(code connect.Code) int {
+			switch code {
+			case connect.CodeResourceExhausted:
+				return http.StatusServiceUnavailable
+			case connect.CodeInvalidArgument:
+				return http.StatusOK // not an error status, so ignored
+			default:
+				return 0
+			}
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	for _, testCase := range []struct {
+		code   connect.Code
+		status int
+	}{
+		{connect.CodeResourceExhausted, http.StatusServiceUnavailable},
+		{connect.CodeInvalidArgument, http.StatusBadRequest},
+		{connect.CodeNotFound, http.StatusNotFound},
+	} {
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+pingv1connect.PingServiceFailProcedure,
+			strings.NewReader(`{"code": `+strconv.Itoa(int(testCase.code))+`}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		_ = response.Body.Close()
+		assert.Equal(t, response.StatusCode, testCase.status, assert.Sprintf("code %v", testCase.code))
+
+		// The body still carries the original code.
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(testCase.code)}))
+		assert.Equal(t, connect.CodeOf(err), testCase.code)
+	}
+}
+
+func TestHandlerGRPCWebTrailerFrame(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(
+			_ context.Context,
+			_ *connect.Request[pingv1.CountUpRequest],
+			stream *connect.ServerStream[pingv1.CountUpResponse],
+		) error {
+			stream.ResponseTrailer().Set("Custom-Trailer", "foo")
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			return connect.NewError(connect.CodeNotFound, errors.New("no more numbers"))
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		server.URL+pingv1connect.PingServiceCountUpProcedure,
+		bytes.NewReader([]byte{0, 0, 0, 0, 0}),
+	)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/grpc-web+proto")
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	// With a message in the body, the status belongs in the trailer frame
+	// rather than the headers or HTTP trailers.
+	assert.Zero(t, response.Header.Get("Grpc-Status"))
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, len(response.Trailer), 0)
+
+	message, err := proto.Marshal(&pingv1.CountUpResponse{Number: 1})
+	assert.Nil(t, err)
+	status, err := proto.Marshal(&statusv1.Status{Code: int32(connect.CodeNotFound), Message: "no more numbers"})
+	assert.Nil(t, err)
+	payload := "custom-trailer: foo\r\n" +
+		"grpc-message: no more numbers\r\n" +
+		"grpc-status: 5\r\n" +
+		"grpc-status-details-bin: " + connect.EncodeBinaryHeader(status) + "\r\n"
+	var want []byte
+	want = append(want, 0)
+	want = binary.BigEndian.AppendUint32(want, uint32(len(message)))
+	want = append(want, message...)
+	want = append(want, 0x80)
+	want = binary.BigEndian.AppendUint32(want, uint32(len(payload)))
+	want = append(want, payload...)
+	assert.Equal(t, body, want)
+}
+
+func TestHandlerGRPCWebText(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	message, err := proto.Marshal(&pingv1.CountUpRequest{Number: 2})
+	assert.Nil(t, err)
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	// Browsers may send the prefix and message as separately padded segments.
+	body := base64.StdEncoding.EncodeToString(prefix) + base64.StdEncoding.EncodeToString(message)
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		server.URL+pingv1connect.PingServiceCountUpProcedure,
+		strings.NewReader(body),
+	)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/grpc-web-text")
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	assert.Equal(t, response.Header.Get("Content-Type"), "application/grpc-web-text")
+
+	encoded, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	// Each write is padded independently, so decode quantum by quantum.
+	var decoded []byte
+	for i := 0; i+4 <= len(encoded); i += 4 {
+		quantum, err := base64.StdEncoding.DecodeString(string(encoded[i : i+4]))
+		assert.Nil(t, err)
+		decoded = append(decoded, quantum...)
+	}
+	reader := bytes.NewReader(decoded)
+	var numbers []int64
+	for {
+		var prefix [5]byte
+		_, err := io.ReadFull(reader, prefix[:])
+		assert.Nil(t, err)
+		frame := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		_, err = io.ReadFull(reader, frame)
+		assert.Nil(t, err)
+		if prefix[0]&0b10000000 != 0 {
+			assert.True(t, strings.Contains(string(frame), "grpc-status: 0"))
+			break
+		}
+		var msg pingv1.CountUpResponse
+		assert.Nil(t, proto.Unmarshal(frame, &msg))
+		numbers = append(numbers, msg.GetNumber())
+	}
+	assert.Equal(t, numbers, []int64{1, 2})
+	assert.Equal(t, reader.Len(), 0)
+}
+
+func TestOnDeadlineApproaching(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			approaching := make(chan struct{})
+			connect.OnDeadlineApproaching(ctx, 0.5, func() { close(approaching) })
+			canceled := connect.OnDeadlineApproaching(ctx, 0.1, func() { t.Error("stopped callback ran") })
+			assert.True(t, canceled())
+			select {
+			case <-approaching:
+				// Return partial results before the deadline.
+				return connect.NewResponse(&pingv1.PingResponse{Text: "partial"}), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		cancel()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "partial")
+	}
+	// Without a deadline, the callback never runs.
+	stop := connect.OnDeadlineApproaching(context.Background(), 0.5, func() { t.Error("callback ran without deadline") })
+	assert.False(t, stop())
+}
@@ -0,0 +1,160 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// SetHeader adds headers to the response of the RPC handled with ctx, so code
+// deep in a handler's call stack can set headers without a reference to the
+// stream. Repeated calls accumulate. Handlers send the headers with the first
+// response message (or with the error, if there are no messages), alongside
+// any set directly on the stream or response.
+//
+// SetHeader returns an error if ctx doesn't belong to an RPC handler, or if
+// the response headers have already been sent.
+func SetHeader(ctx context.Context, header http.Header) error {
+	metadata, err := handlerMetadataFromContext(ctx, "SetHeader")
+	if err != nil {
+		return err
+	}
+	return metadata.addHeader(header)
+}
+
+// SetTrailer adds trailing metadata to the response of the RPC handled with
+// ctx, so code deep in a handler's call stack can set trailers without a
+// reference to the stream. Repeated calls accumulate. Handlers send the
+// trailers when the RPC ends, alongside any set directly on the stream or
+// response.
+//
+// SetTrailer returns an error if ctx doesn't belong to an RPC handler, or if
+// the RPC has already ended.
+func SetTrailer(ctx context.Context, trailer http.Header) error {
+	metadata, err := handlerMetadataFromContext(ctx, "SetTrailer")
+	if err != nil {
+		return err
+	}
+	return metadata.addTrailer(trailer)
+}
+
+// AppendTrailer adds a single trailing metadata value to the response of the
+// RPC handled with ctx. See [SetTrailer].
+func AppendTrailer(ctx context.Context, key, value string) error {
+	return SetTrailer(ctx, http.Header{http.CanonicalHeaderKey(key): []string{value}})
+}
+
+// handlerMetadata holds the metadata handlers set through the context until
+// the RPC sends it.
+type handlerMetadata struct {
+	mu         sync.Mutex
+	header     http.Header
+	headerSent bool
+	trailer    http.Header
+	closed     bool
+}
+
+func handlerMetadataFromContext(ctx context.Context, caller string) (*handlerMetadata, *Error) {
+	state := rpcStateFromContext(ctx)
+	if state == nil || state.metadata == nil {
+		return nil, errorf(CodeInternal, "%s: context doesn't belong to an RPC handler", caller)
+	}
+	return state.metadata, nil
+}
+
+func (m *handlerMetadata) addHeader(header http.Header) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.headerSent {
+		return errorf(CodeInternal, "SetHeader: response headers have already been sent")
+	}
+	m.header = mergeCanonical(m.header, header)
+	return nil
+}
+
+func (m *handlerMetadata) addTrailer(trailer http.Header) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errorf(CodeInternal, "SetTrailer: RPC has already ended")
+	}
+	m.trailer = mergeCanonical(m.trailer, trailer)
+	return nil
+}
+
+// takeHeader returns the accumulated headers and rejects any set later.
+func (m *handlerMetadata) takeHeader() http.Header {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.headerSent = true
+	header := m.header
+	m.header = nil
+	return header
+}
+
+// takeTrailer returns the accumulated trailers and rejects any set later.
+func (m *handlerMetadata) takeTrailer() http.Header {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	trailer := m.trailer
+	m.trailer = nil
+	return trailer
+}
+
+// handlerMetadataConn sends the metadata set through the context.
+type handlerMetadataConn struct {
+	handlerConnCloser
+
+	metadata *handlerMetadata
+}
+
+func (c *handlerMetadataConn) Send(msg any) error {
+	mergeHeaders(c.ResponseHeader(), c.metadata.takeHeader())
+	if c.Spec().StreamType == StreamTypeUnary {
+		// Unary Connect responses write their trailers along with the
+		// message, and a unary handler has returned before it sends.
+		mergeHeaders(c.ResponseTrailer(), c.metadata.takeTrailer())
+	}
+	return c.handlerConnCloser.Send(msg)
+}
+
+func (c *handlerMetadataConn) Close(err error) error {
+	mergeHeaders(c.ResponseHeader(), c.metadata.takeHeader())
+	mergeHeaders(c.ResponseTrailer(), c.metadata.takeTrailer())
+	return c.handlerConnCloser.Close(err)
+}
+
+func (c *handlerMetadataConn) getHTTPMethod() string {
+	if methoder, ok := c.handlerConnCloser.(interface{ getHTTPMethod() string }); ok {
+		return methoder.getHTTPMethod()
+	}
+	return http.MethodPost
+}
+
+// mergeCanonical adds the values from the source into the destination under
+// canonical keys, allocating the destination if necessary.
+func mergeCanonical(into, from http.Header) http.Header {
+	if into == nil {
+		into = make(http.Header, len(from))
+	}
+	for key, values := range from {
+		key = http.CanonicalHeaderKey(key)
+		into[key] = append(into[key], values...)
+	}
+	return into
+}
@@ -15,9 +15,14 @@
 package connect
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"syscall"
 )
 
 // ClientStream is the handler's view of a client streaming RPC.
@@ -25,9 +30,12 @@ import (
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ClientStream[Req any] struct {
-	conn StreamingHandlerConn
-	msg  *Req
-	err  error
+	ctx      context.Context //nolint:containedctx
+	conn     StreamingHandlerConn
+	msg      *Req
+	reuseMsg bool
+	err      error
+	stats    *streamStats
 }
 
 // Spec returns the specification for the RPC.
@@ -54,11 +62,22 @@ func (c *ClientStream[Req]) Receive() bool {
 	if c.err != nil {
 		return false
 	}
-	c.msg = new(Req)
-	c.err = c.conn.Receive(c.msg)
+	c.msg = nextMsg(c.msg, c.reuseMsg)
+	c.err = cleanEOF(receiveFromClient(c.ctx, c.conn, c.msg))
 	return c.err == nil
 }
 
+// SetReuseMsg controls whether Receive allocates a new message for each call.
+// When reuse is enabled, Receive resets the previous message and unmarshals
+// into it instead, which reduces garbage in hot loops. The message returned by
+// Msg is then only valid until the next call to Receive: handlers must copy
+// out any data they need before receiving again.
+//
+// By default, each call to Receive allocates a new message.
+func (c *ClientStream[Req]) SetReuseMsg(reuse bool) {
+	c.reuseMsg = reuse
+}
+
 // Msg returns the most recent message unmarshaled by a call to Receive.
 func (c *ClientStream[Req]) Msg() *Req {
 	if c.msg == nil {
@@ -75,6 +94,30 @@ func (c *ClientStream[Req]) Err() error {
 	return c.err
 }
 
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (c *ClientStream[Req]) BytesSent() int64 {
+	return c.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (c *ClientStream[Req]) BytesReceived() int64 {
+	return c.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (c *ClientStream[Req]) CompressionStats() CompressionStats {
+	return c.stats.compression()
+}
+
+// ContentType returns the request's Content-Type. See
+// [ClientStreamForClient.ContentType].
+func (c *ClientStream[Req]) ContentType() string {
+	return getHeaderCanonical(c.conn.RequestHeader(), headerContentType)
+}
+
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
@@ -86,7 +129,9 @@ func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ServerStream[Res any] struct {
-	conn StreamingHandlerConn
+	ctx   context.Context //nolint:containedctx
+	conn  StreamingHandlerConn
+	stats *streamStats
 }
 
 // ResponseHeader returns the response headers. Headers are sent with the first
@@ -109,11 +154,39 @@ func (s *ServerStream[Res]) ResponseTrailer() http.Header {
 
 // Send a message to the client. The first call to Send also sends the response
 // headers.
+//
+// Once the client has gone away, Send returns an error with [CodeCanceled]
+// (or [CodeDeadlineExceeded], if the RPC timed out) without writing anything,
+// so handlers can stop producing messages.
 func (s *ServerStream[Res]) Send(msg *Res) error {
 	if msg == nil {
-		return s.conn.Send(nil)
+		return sendToClient(s.ctx, s.conn, nil)
 	}
-	return s.conn.Send(msg)
+	return sendToClient(s.ctx, s.conn, msg)
+}
+
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (s *ServerStream[Res]) BytesSent() int64 {
+	return s.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (s *ServerStream[Res]) BytesReceived() int64 {
+	return s.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (s *ServerStream[Res]) CompressionStats() CompressionStats {
+	return s.stats.compression()
+}
+
+// ContentType returns the request's Content-Type. See
+// [ClientStreamForClient.ContentType].
+func (s *ServerStream[Res]) ContentType() string {
+	return getHeaderCanonical(s.conn.RequestHeader(), headerContentType)
 }
 
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
@@ -127,7 +200,10 @@ func (s *ServerStream[Res]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type BidiStream[Req, Res any] struct {
-	conn StreamingHandlerConn
+	ctx        context.Context //nolint:containedctx
+	conn       StreamingHandlerConn
+	stats      *streamStats
+	requestEOF *readAheadBody
 }
 
 // Spec returns the specification for the RPC.
@@ -145,16 +221,33 @@ func (b *BidiStream[Req, Res]) RequestHeader() http.Header {
 	return b.conn.RequestHeader()
 }
 
-// Receive a message. When the client is done sending messages, Receive will
-// return an error that wraps [io.EOF].
+// Receive a message. When the client is done sending messages, Receive
+// returns [io.EOF] itself, so handlers can compare the error directly. Other
+// errors, like malformed messages, a canceled context, or a client that
+// disconnects mid-stream, never wrap io.EOF.
 func (b *BidiStream[Req, Res]) Receive() (*Req, error) {
 	var req Req
-	if err := b.conn.Receive(&req); err != nil {
-		return nil, err
+	if err := receiveFromClient(b.ctx, b.conn, &req); err != nil {
+		return nil, cleanEOF(err)
 	}
 	return &req, nil
 }
 
+// SendClosed returns a channel that's closed once the client has finished
+// sending messages (a half-close), so handlers can notice the end of the
+// request stream while they're still producing responses, without calling
+// Receive.
+//
+// To notice the half-close, the first call to SendClosed starts reading the
+// request in the background, buffering up to 64 KiB ahead of Receive. The
+// channel may therefore close while messages are still waiting to be
+// received: Receive returns them as usual, followed by io.EOF.
+// If the client sends more than fits in the buffer without the handler
+// receiving it, the channel doesn't close until Receive catches up.
+func (b *BidiStream[Req, Res]) SendClosed() <-chan struct{} {
+	return b.requestEOF.sendClosed()
+}
+
 // ResponseHeader returns the response headers. Headers are sent with the first
 // call to Send.
 //
@@ -174,12 +267,37 @@ func (b *BidiStream[Req, Res]) ResponseTrailer() http.Header {
 }
 
 // Send a message to the client. The first call to Send also sends the response
-// headers.
+// headers. Like [ServerStream.Send], it returns an error with [CodeCanceled]
+// once the client has gone away.
 func (b *BidiStream[Req, Res]) Send(msg *Res) error {
 	if msg == nil {
-		return b.conn.Send(nil)
+		return sendToClient(b.ctx, b.conn, nil)
 	}
-	return b.conn.Send(msg)
+	return sendToClient(b.ctx, b.conn, msg)
+}
+
+// BytesSent returns the number of bytes written to the network for this RPC so
+// far. Unlike message sizes, it includes envelopes and compression.
+func (b *BidiStream[Req, Res]) BytesSent() int64 {
+	return b.stats.sent()
+}
+
+// BytesReceived returns the number of bytes read from the network for this RPC
+// so far. Unlike message sizes, it includes envelopes and compression.
+func (b *BidiStream[Req, Res]) BytesReceived() int64 {
+	return b.stats.received()
+}
+
+// CompressionStats returns the sizes of the messages sent and received so far,
+// before and after compression.
+func (b *BidiStream[Req, Res]) CompressionStats() CompressionStats {
+	return b.stats.compression()
+}
+
+// ContentType returns the request's Content-Type. See
+// [ClientStreamForClient.ContentType].
+func (b *BidiStream[Req, Res]) ContentType() string {
+	return getHeaderCanonical(b.conn.RequestHeader(), headerContentType)
 }
 
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
@@ -187,3 +305,215 @@ func (b *BidiStream[Req, Res]) Send(msg *Res) error {
 func (b *BidiStream[Req, Res]) Conn() StreamingHandlerConn {
 	return b.conn
 }
+
+// cleanEOF converts the error that handler connections return when the
+// client has finished sending into a bare io.EOF. Framing errors from
+// truncated messages wrap io.ErrUnexpectedEOF rather than io.EOF, so they're
+// left alone.
+func cleanEOF(err error) error {
+	if err != nil && errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	return err
+}
+
+// receiveFromClient checks the RPC's context before receiving, so handlers
+// that loop on Receive stop promptly once the deadline passes or the client
+// goes away, even if more messages are already buffered.
+func receiveFromClient(ctx context.Context, conn StreamingHandlerConn, msg any) error {
+	if err := ctx.Err(); err != nil {
+		return wrapIfContextError(err)
+	}
+	return conn.Receive(msg)
+}
+
+// sendToClient checks the RPC's context before sending, and attributes write
+// failures to the client's departure rather than returning raw network
+// errors. Writes usually fail because the client disconnected or reset the
+// stream, which net/http reports by canceling the context; if the context is
+// still live, the connection broke some other way and the client may retry.
+func sendToClient(ctx context.Context, conn StreamingHandlerConn, msg any) error {
+	if err := ctx.Err(); err != nil {
+		return wrapIfContextError(err)
+	}
+	err := conn.Send(msg)
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return wrapIfContextError(ctxErr)
+	}
+	if isBrokenConnection(err) {
+		return NewError(CodeUnavailable, err)
+	}
+	return err
+}
+
+// isBrokenConnection reports whether err comes from writing to a connection
+// that the peer has closed.
+func isBrokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// requestEOFFromContext returns the request body wrapper bidi handlers use to
+// learn when the request ends, if any.
+func requestEOFFromContext(ctx context.Context) *readAheadBody {
+	if state := rpcStateFromContext(ctx); state != nil {
+		return state.requestEOF
+	}
+	return nil
+}
+
+// readAheadMaxBytes bounds how far readAheadBody reads ahead of the handler.
+const readAheadMaxBytes = 64 * 1024
+
+// readAheadBody notices when a request body reaches its end. Until someone
+// asks for the notification, it reads the body directly, noticing the end
+// only when the handler reads it. Afterwards, a background goroutine reads
+// ahead of the handler into a bounded buffer, so it notices the end even if
+// the handler never reads again.
+type readAheadBody struct {
+	body io.ReadCloser
+	done chan struct{}
+
+	doneOnce sync.Once
+	reading  sync.WaitGroup // the readAhead goroutine
+
+	mu            sync.Mutex
+	cond          *sync.Cond // signaled when buffer, err, or closed change
+	readingDirect bool       // a Read is using the body directly
+	wantReadAhead bool
+	readingAhead  bool
+	closed        bool
+	buffer        bytes.Buffer // read ahead, but not yet returned by Read
+	err           error        // from the body, returned once buffer is drained
+}
+
+func newReadAheadBody(body io.ReadCloser) *readAheadBody {
+	reader := &readAheadBody{body: body, done: make(chan struct{})}
+	reader.cond = sync.NewCond(&reader.mu)
+	return reader
+}
+
+// sendClosed returns a channel that's closed once the body has reached its
+// end, starting to read ahead if necessary. A nil *readAheadBody returns a
+// channel that's never closed.
+func (r *readAheadBody) sendClosed() <-chan struct{} {
+	if r == nil {
+		return make(chan struct{})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wantReadAhead = true
+	// If a Read is using the body, it starts reading ahead when it's done.
+	if !r.readingDirect {
+		r.startReadAheadLocked()
+	}
+	return r.done
+}
+
+func (r *readAheadBody) startReadAheadLocked() {
+	if r.readingAhead || r.closed {
+		return
+	}
+	select {
+	case <-r.done:
+		// We already know the body has ended.
+		return
+	default:
+	}
+	r.readingAhead = true
+	r.reading.Add(1)
+	go r.readAhead()
+}
+
+func (r *readAheadBody) Read(data []byte) (int, error) {
+	r.mu.Lock()
+	if r.readingAhead {
+		n, err := r.readBufferedLocked(data)
+		r.mu.Unlock()
+		return n, err
+	}
+	r.readingDirect = true
+	r.mu.Unlock()
+	n, err := r.body.Read(data)
+	if errors.Is(err, io.EOF) {
+		r.markDone()
+	}
+	r.mu.Lock()
+	r.readingDirect = false
+	if r.wantReadAhead && err == nil {
+		r.startReadAheadLocked()
+	}
+	r.mu.Unlock()
+	return n, err
+}
+
+// readBufferedLocked reads from the buffer filled by readAhead, waiting for
+// data if it's empty. It must be called with r.mu held.
+func (r *readAheadBody) readBufferedLocked(data []byte) (int, error) {
+	for r.buffer.Len() == 0 && r.err == nil && !r.closed {
+		r.cond.Wait()
+	}
+	if r.buffer.Len() > 0 {
+		n, _ := r.buffer.Read(data)
+		r.cond.Broadcast()
+		return n, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, net.ErrClosed
+}
+
+// readAhead reads the body in the background until it ends or the reader is
+// closed, pausing whenever the buffer is full.
+func (r *readAheadBody) readAhead() {
+	defer r.reading.Done()
+	scratch := make([]byte, readAheadMaxBytes/4)
+	for {
+		r.mu.Lock()
+		for r.buffer.Len() >= readAheadMaxBytes && !r.closed {
+			r.cond.Wait()
+		}
+		if r.closed {
+			r.mu.Unlock()
+			return
+		}
+		want := readAheadMaxBytes - r.buffer.Len()
+		r.mu.Unlock()
+		if want > len(scratch) {
+			want = len(scratch)
+		}
+		n, err := r.body.Read(scratch[:want])
+		if errors.Is(err, io.EOF) {
+			r.markDone()
+		}
+		r.mu.Lock()
+		r.buffer.Write(scratch[:n])
+		r.err = err
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *readAheadBody) markDone() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
+// Close closes the body, and waits for any background read to return, so
+// the body isn't used after ServeHTTP returns.
+func (r *readAheadBody) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	err := r.body.Close()
+	r.reading.Wait()
+	return err
+}
@@ -15,8 +15,18 @@
 package connect
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"connectrpc.com/connect/internal/assert"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
@@ -27,7 +37,7 @@ func TestClientStreamIterator(t *testing.T) {
 	// The server's view of a client streaming RPC is an iterator. For safety,
 	// and to match grpc-go's behavior, we should allocate a new message for each
 	// iteration.
-	stream := &ClientStream[pingv1.PingRequest]{conn: &nopStreamingHandlerConn{}}
+	stream := &ClientStream[pingv1.PingRequest]{ctx: context.Background(), conn: &nopStreamingHandlerConn{}}
 	assert.True(t, stream.Receive())
 	first := fmt.Sprintf("%p", stream.Msg())
 	assert.True(t, stream.Receive())
@@ -35,6 +45,27 @@ func TestClientStreamIterator(t *testing.T) {
 	assert.NotEqual(t, first, second, assert.Sprintf("should allocate a new message for each iteration"))
 }
 
+func TestHandlerStreamsReceiveExpiredContext(t *testing.T) {
+	t.Parallel()
+	// Messages are available, but the deadline has already passed.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	clientStream := &ClientStream[pingv1.PingRequest]{ctx: ctx, conn: &nopStreamingHandlerConn{}}
+	assert.False(t, clientStream.Receive())
+	assert.Equal(t, CodeOf(clientStream.Err()), CodeDeadlineExceeded)
+
+	bidiStream := &BidiStream[pingv1.PingRequest, pingv1.PingResponse]{ctx: ctx, conn: &nopStreamingHandlerConn{}}
+	_, err := bidiStream.Receive()
+	assert.Equal(t, CodeOf(err), CodeDeadlineExceeded)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	bidiStream = &BidiStream[pingv1.PingRequest, pingv1.PingResponse]{ctx: ctx, conn: &nopStreamingHandlerConn{}}
+	_, err = bidiStream.Receive()
+	assert.Equal(t, CodeOf(err), CodeCanceled)
+	assert.False(t, errors.Is(err, io.EOF))
+}
+
 type nopStreamingHandlerConn struct {
 	StreamingHandlerConn
 }
@@ -42,3 +73,79 @@ type nopStreamingHandlerConn struct {
 func (nopStreamingHandlerConn) Receive(msg any) error {
 	return nil
 }
+
+func TestReadAheadBody(t *testing.T) {
+	t.Parallel()
+	t.Run("small", func(t *testing.T) {
+		t.Parallel()
+		// The end of a body that fits in the buffer is noticed without reads.
+		reader := newReadAheadBody(io.NopCloser(iotest.OneByteReader(strings.NewReader("hello"))))
+		select {
+		case <-reader.sendClosed():
+		case <-time.After(5 * time.Second):
+			t.Fatal("didn't notice the end of the body")
+		}
+		data, err := io.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data), "hello")
+		assert.Nil(t, reader.Close())
+	})
+	t.Run("large", func(t *testing.T) {
+		t.Parallel()
+		// Bodies larger than the buffer end once the reader catches up.
+		body := bytes.Repeat([]byte("0123456789"), readAheadMaxBytes/5)
+		reader := newReadAheadBody(io.NopCloser(bytes.NewReader(body)))
+		done := reader.sendClosed()
+		time.Sleep(10 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("read past the buffer")
+		default:
+		}
+		data, err := io.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, data, body)
+		<-done
+	})
+	t.Run("close", func(t *testing.T) {
+		t.Parallel()
+		// Close waits for the background read to return.
+		body := &blockingBody{reading: make(chan struct{}), closed: make(chan struct{})}
+		reader := newReadAheadBody(body)
+		reader.sendClosed()
+		<-body.reading
+		assert.Nil(t, reader.Close())
+		assert.True(t, body.returned.Load())
+	})
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+		var reader *readAheadBody
+		select {
+		case <-reader.sendClosed():
+			t.Fatal("nil reader reported the end of a body")
+		default:
+		}
+	})
+}
+
+// blockingBody blocks reads until it's closed.
+type blockingBody struct {
+	reading     chan struct{}
+	readingOnce sync.Once
+	closed      chan struct{}
+	closeOnce   sync.Once
+	returned    atomic.Bool
+}
+
+func (b *blockingBody) Read([]byte) (int, error) {
+	b.readingOnce.Do(func() { close(b.reading) })
+	<-b.closed
+	time.Sleep(10 * time.Millisecond)
+	b.returned.Store(true)
+	return 0, net.ErrClosed
+}
+
+func (b *blockingBody) Close() error {
+	b.closeOnce.Do(func() { close(b.closed) })
+	return nil
+}
@@ -15,8 +15,10 @@
 package connect
 
 import (
+	"context"
 	"encoding/base64"
 	"net/http"
+	"strings"
 )
 
 // EncodeBinaryHeader base64-encodes the data. It always emits unpadded values.
@@ -51,6 +53,48 @@ func mergeHeaders(into, from http.Header) {
 	}
 }
 
+type initialMetadataContextKey struct{}
+
+// ContextWithInitialMetadata adds headers to the requests of RPCs made with the
+// returned context. It's the per-call counterpart to [WithHeaders]: for each
+// key in header, the values replace any the client adds with [WithHeader] or
+// WithHeaders. Headers set on individual requests are still added alongside
+// them. Repeated calls replace the headers set by earlier calls.
+//
+// As with WithHeaders, reserved headers aren't allowed. RPCs made with a
+// context carrying a reserved or malformed header fail with
+// [CodeInvalidArgument].
+func ContextWithInitialMetadata(ctx context.Context, header http.Header) context.Context {
+	clone := make(http.Header, len(header))
+	for key, values := range header {
+		clone[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	return context.WithValue(ctx, initialMetadataContextKey{}, clone)
+}
+
+// initialMetadataFromContext returns the headers set with
+// ContextWithInitialMetadata, if any.
+func initialMetadataFromContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(initialMetadataContextKey{}).(http.Header)
+	return header
+}
+
+// mergeRequestHeaders adds the client-wide headers and the call's initial
+// metadata to a request's headers. The initial metadata takes precedence:
+// client-wide values for the same keys are dropped.
+func mergeRequestHeaders(into, clientHeader, initialMetadata http.Header) {
+	if len(initialMetadata) == 0 {
+		mergeHeaders(into, clientHeader)
+		return
+	}
+	for key, values := range clientHeader {
+		if _, ok := initialMetadata[key]; !ok {
+			into[key] = append(into[key], values...)
+		}
+	}
+	mergeHeaders(into, initialMetadata)
+}
+
 // getHeaderCanonical is a shortcut for Header.Get() which
 // bypasses the CanonicalMIMEHeaderKey operation when we
 // know the key is already in canonical form.
@@ -85,3 +129,76 @@ func delHeaderCanonical(h http.Header, key string) {
 func addHeaderCanonical(h http.Header, key, value string) {
 	h[key] = append(h[key], value)
 }
+
+// headerBytes returns the total length of the keys and values in the header.
+func headerBytes(header http.Header) int {
+	var size int
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
+
+// isReservedHeader reports whether the RPC protocols manage the header, so
+// users may not set it statically.
+func isReservedHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case headerContentType, headerContentLength, headerHost, headerTrailer,
+		headerContentEncoding, headerAcceptEncoding, "Te",
+		connectHeaderProtocolVersion, connectHeaderTimeout,
+		connectStreamingHeaderCompression, connectStreamingHeaderAcceptCompression:
+		return true
+	}
+	return strings.HasPrefix(http.CanonicalHeaderKey(key), "Grpc-")
+}
+
+// validateRequestHeaders checks that users may send the headers, reporting
+// problems with the supplied code.
+func validateRequestHeaders(header http.Header, code Code) *Error {
+	for key, values := range header {
+		if !isValidHeaderName(key) {
+			return errorf(code, "invalid header name %q", key)
+		}
+		if isReservedHeader(key) {
+			return errorf(code, "header %q is reserved for protocol use", key)
+		}
+		for _, value := range values {
+			if !isValidHeaderValue(value) {
+				return errorf(code, "invalid value for header %q", key)
+			}
+		}
+	}
+	return nil
+}
+
+// isValidHeaderName reports whether the key is a valid HTTP field name: a
+// non-empty token, as defined in RFC 9110 section 5.1.
+func isValidHeaderName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		char := key[i]
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", char) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isValidHeaderValue reports whether the value is a valid HTTP field value. It
+// rejects control characters other than horizontal tab, which would let
+// values smuggle in extra headers.
+func isValidHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if char := value[i]; (char < ' ' && char != '\t') || char == 0x7f {
+			return false
+		}
+	}
+	return true
+}
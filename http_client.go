@@ -0,0 +1,563 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// An HTTPClientOption configures the *http.Client returned by
+// [NewHTTPClient].
+type HTTPClientOption interface {
+	applyToHTTPClient(*httpClientConfig)
+}
+
+// NewHTTPClient returns an *http.Client suitable for use with [NewClient]. Its
+// transport starts with the settings of [http.DefaultTransport], including
+// proxy support and dial timeouts, and attempts to negotiate HTTP/2 over TLS
+// even when TLS is customized with options.
+//
+// Use NewHTTPClient when you'd otherwise need to build an *http.Transport by
+// hand, for example to change TLS settings.
+func NewHTTPClient(options ...HTTPClientOption) *http.Client {
+	var config httpClientConfig
+	for _, opt := range options {
+		opt.applyToHTTPClient(&config)
+	}
+	transport := config.newTransport()
+	if config.MaxConnAge > 0 {
+		return &http.Client{Transport: newAgingTransport(transport, &config)}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// DefaultGRPCClient returns an *http.Client configured for gRPC, including
+// streaming RPCs. Like [NewHTTPClient], it negotiates HTTP/2 over TLS, which
+// gRPC requires. It also disables the transport's automatic compression:
+// otherwise, net/http asks servers to gzip responses and silently
+// decompresses them, which conflicts with gRPC's own per-message compression
+// negotiated with the Grpc-Encoding and Grpc-Accept-Encoding headers.
+//
+// Connect clients always set Accept-Encoding themselves, so this is a
+// safeguard rather than a requirement. The client has no overall timeout,
+// since [http.Client.Timeout] would cut off long-lived streams; use context
+// deadlines to bound individual RPCs. Dial and TLS handshake timeouts are the
+// same as [http.DefaultTransport].
+//
+// The client only speaks HTTP/2 over TLS. Servers accepting cleartext HTTP/2
+// (h2c) need a transport configured for it.
+func DefaultGRPCClient() *http.Client {
+	client := NewHTTPClient()
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		transport.DisableCompression = true
+	}
+	return client
+}
+
+// DoerFromHTTPClient adapts an existing *http.Client for gRPC, as described
+// in [DefaultGRPCClient]. If the client uses an *http.Transport (or the
+// default transport), the returned client uses a copy of it that negotiates
+// HTTP/2 and doesn't compress automatically. The original client is never
+// modified, and other settings, including any [http.Client.Timeout], are
+// kept as is.
+//
+// Clients with other kinds of transports are returned unchanged.
+func DoerFromHTTPClient(client *http.Client) HTTPClient {
+	if client == nil {
+		return DefaultGRPCClient()
+	}
+	roundTripper := client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	transport, ok := roundTripper.(*http.Transport)
+	if !ok {
+		return client
+	}
+	transport = transport.Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.DisableCompression = true
+	adapted := *client
+	adapted.Transport = transport
+	return &adapted
+}
+
+// WithTLSServerName sets the server name used to verify the server's
+// certificate and sent in the TLS handshake for SNI. By default, the host
+// from the request URL is used. Override it when the URL names something
+// other than the certificate, like a load balancer's IP address.
+//
+// The server name only affects TLS. The Host header is still taken from the
+// URL passed to [NewClient].
+func WithTLSServerName(name string) HTTPClientOption {
+	return &tlsServerNameOption{name: name}
+}
+
+// WithRootCAs sets the certificate authorities the client trusts to sign
+// server certificates, replacing the system's roots. Use it for servers with
+// certificates issued by a private PKI; [CertPoolFromPEMFile] loads a pool
+// from a file. Combined with [WithClientCertificates] and
+// [WithTLSServerName], it configures mutual TLS without building a transport
+// by hand.
+//
+// By default, the client trusts the host's root certificates.
+func WithRootCAs(pool *x509.CertPool) HTTPClientOption {
+	return &rootCAsOption{pool: pool}
+}
+
+// WithClientCertificates sets the certificates the client presents when
+// servers request them, as they do for mutual TLS. Load certificates with
+// [tls.LoadX509KeyPair].
+func WithClientCertificates(certificates ...tls.Certificate) HTTPClientOption {
+	return &clientCertificatesOption{certificates: certificates}
+}
+
+// CertPoolFromPEMFile reads PEM-encoded certificates, like a private
+// certificate authority's root certificate, from a file for use with
+// [WithRootCAs]. It returns an error if the file doesn't contain any
+// certificates.
+func CertPoolFromPEMFile(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM-encoded certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// WithInsecureSkipVerify disables verification of the server's certificate
+// chain and host name. It's meant only for local development against servers
+// with self-signed certificates.
+//
+// DO NOT USE THIS OPTION IN PRODUCTION. Without verification, TLS still
+// encrypts traffic, but anyone who can intercept it can impersonate the
+// server and read or modify every request and response. To trust a private
+// certificate authority, use [WithRootCAs] instead.
+//
+// WithInsecureSkipVerify composes with the other TLS options: for example,
+// [WithTLSServerName] still controls the server name sent for SNI, and
+// [WithClientCertificates] still supplies client certificates.
+func WithInsecureSkipVerify() HTTPClientOption {
+	return &insecureSkipVerifyOption{}
+}
+
+// WithHTTP2ConnWindowSize sets the maximum HTTP/2 flow control window for
+// data received on each connection. Together with
+// [WithHTTP2StreamWindowSize], it bounds how much data a server may send
+// before the client acknowledges it: on links with a high
+// bandwidth-delay product, small windows cap throughput at roughly the window
+// size per round trip, while large windows let a few busy streams consume
+// more memory.
+//
+// Go's defaults already favor throughput, so most users don't need this
+// option. Before Go 1.24, net/http doesn't expose HTTP/2 settings, so
+// programs built with earlier versions accept the option but ignore it.
+func WithHTTP2ConnWindowSize(bytes int) HTTPClientOption {
+	return &http2WindowSizeOption{conn: bytes}
+}
+
+// WithHTTP2StreamWindowSize sets the maximum HTTP/2 flow control window for
+// data received on each stream. See [WithHTTP2ConnWindowSize] for the
+// effect on throughput. Like WithHTTP2ConnWindowSize, it's ignored by
+// programs built with Go versions before 1.24.
+func WithHTTP2StreamWindowSize(bytes int) HTTPClientOption {
+	return &http2WindowSizeOption{stream: bytes}
+}
+
+// WithMaxConnAge limits how long the client keeps using each connection.
+// Long-lived connections, especially HTTP/2 connections multiplexing many
+// RPCs, pin a client to the servers it happened to dial first; recycling them
+// periodically makes the client re-resolve DNS and spreads load across
+// servers added later.
+//
+// net/http doesn't expose individual connections, so the client recycles them
+// in batches: it routes RPCs through a succession of transports, and retires
+// the current one once it's older than age, even if the client is idle. From
+// then on, new RPCs use fresh connections from the replacement, and the
+// retired transport's idle connections are closed. RPCs already in flight,
+// including long-lived streams, get up to grace longer to finish on their old
+// connections, which are closed once the last of them ends. When the grace
+// period runs out, the remaining connections are closed and the RPCs still
+// using them fail. A grace of zero closes busy connections as soon as they
+// reach the maximum age. Ages are jittered by up to 10% so clients started
+// together don't all reconnect at once.
+//
+// With this option, the returned client's Transport isn't an
+// *http.Transport. By default, connections are reused until they're idle for
+// longer than the transport's IdleConnTimeout.
+func WithMaxConnAge(age, grace time.Duration) HTTPClientOption {
+	return &maxConnAgeOption{age: age, grace: grace}
+}
+
+// WithHTTPClientClock configures the [Clock] the client uses to age
+// connections (see [WithMaxConnAge]). Like [WithClock], it's primarily useful
+// in tests.
+//
+// By default, the client uses the system clock. Passing a nil Clock restores
+// the default.
+func WithHTTPClientClock(clock Clock) HTTPClientOption {
+	return &httpClientClockOption{clock: clock}
+}
+
+type httpClientConfig struct {
+	TLSServerName         string
+	InsecureSkipVerify    bool
+	RootCAs               *x509.CertPool
+	ClientCertificates    []tls.Certificate
+	HTTP2ConnWindowSize   int
+	HTTP2StreamWindowSize int
+	MaxConnAge            time.Duration
+	MaxConnAgeGrace       time.Duration
+	Clock                 Clock
+}
+
+func (c *httpClientConfig) newTransport() *http.Transport {
+	var transport *http.Transport
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	} else {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	// Setting TLSClientConfig disables the transport's automatic HTTP/2
+	// support unless we opt back in.
+	transport.ForceAttemptHTTP2 = true
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec // opt-in for development
+		RootCAs:            c.RootCAs,
+		Certificates:       c.ClientCertificates,
+	}
+	configureHTTP2(transport, c)
+	return transport
+}
+
+type tlsServerNameOption struct {
+	name string
+}
+
+func (o *tlsServerNameOption) applyToHTTPClient(config *httpClientConfig) {
+	config.TLSServerName = o.name
+}
+
+type rootCAsOption struct {
+	pool *x509.CertPool
+}
+
+func (o *rootCAsOption) applyToHTTPClient(config *httpClientConfig) {
+	config.RootCAs = o.pool
+}
+
+type clientCertificatesOption struct {
+	certificates []tls.Certificate
+}
+
+func (o *clientCertificatesOption) applyToHTTPClient(config *httpClientConfig) {
+	config.ClientCertificates = append(config.ClientCertificates, o.certificates...)
+}
+
+type insecureSkipVerifyOption struct{}
+
+func (o *insecureSkipVerifyOption) applyToHTTPClient(config *httpClientConfig) {
+	config.InsecureSkipVerify = true
+}
+
+type http2WindowSizeOption struct {
+	conn   int
+	stream int
+}
+
+func (o *http2WindowSizeOption) applyToHTTPClient(config *httpClientConfig) {
+	if o.conn != 0 {
+		config.HTTP2ConnWindowSize = o.conn
+	}
+	if o.stream != 0 {
+		config.HTTP2StreamWindowSize = o.stream
+	}
+}
+
+type maxConnAgeOption struct {
+	age   time.Duration
+	grace time.Duration
+}
+
+func (o *maxConnAgeOption) applyToHTTPClient(config *httpClientConfig) {
+	config.MaxConnAge = o.age
+	config.MaxConnAgeGrace = o.grace
+}
+
+type httpClientClockOption struct {
+	clock Clock
+}
+
+func (o *httpClientClockOption) applyToHTTPClient(config *httpClientConfig) {
+	config.Clock = o.clock
+}
+
+// agingTransport recycles connections after a maximum age. net/http doesn't
+// let us retire a single connection, so it retires whole generations of
+// transports instead: once the current generation is too old, new requests go
+// to a fresh one, and the old one's connections are closed when the requests
+// still using them finish or the grace period ends.
+type agingTransport struct {
+	base  *http.Transport
+	age   time.Duration
+	grace time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	current *transportGeneration
+	retired map[*transportGeneration]struct{}
+}
+
+func newAgingTransport(base *http.Transport, config *httpClientConfig) *agingTransport {
+	clock := config.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &agingTransport{
+		base:    base,
+		age:     config.MaxConnAge,
+		grace:   config.MaxConnAgeGrace,
+		clock:   clock,
+		rand:    rand.New(rand.NewSource(clock.Now().UnixNano())), //nolint:gosec
+		retired: make(map[*transportGeneration]struct{}),
+	}
+}
+
+func (t *agingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	generation := t.acquire()
+	response, err := generation.transport.RoundTrip(request)
+	if err != nil {
+		generation.release()
+		return nil, err
+	}
+	// The request is in flight until the caller is done with the response.
+	response.Body = &generationBody{ReadCloser: response.Body, generation: generation}
+	return response, nil
+}
+
+// CloseIdleConnections closes the idle connections of every generation,
+// including retired ones that are still draining.
+func (t *agingTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	generations := make([]*transportGeneration, 0, len(t.retired)+1)
+	if t.current != nil {
+		generations = append(generations, t.current)
+	}
+	for generation := range t.retired {
+		generations = append(generations, generation)
+	}
+	t.mu.Unlock()
+	for _, generation := range generations {
+		generation.transport.CloseIdleConnections()
+	}
+}
+
+// acquire returns the current generation, replacing it first if it's too
+// old, and counts a request against it.
+func (t *agingTransport) acquire() *transportGeneration {
+	now := t.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && !now.Before(t.current.expires) {
+		// The expiry timer hasn't retired it yet.
+		t.retireLocked(t.current)
+	}
+	if t.current == nil {
+		// Jitter the age by up to 10% in either direction.
+		age := t.age + time.Duration((t.rand.Float64()*0.2-0.1)*float64(t.age))
+		t.current = newTransportGeneration(t.base, now.Add(age))
+		go t.expire(t.current, age)
+	}
+	t.current.mu.Lock()
+	t.current.active++
+	t.current.mu.Unlock()
+	return t.current
+}
+
+// expire retires a generation once it reaches its age, so that clients
+// recycle connections even when they're idle.
+func (t *agingTransport) expire(generation *transportGeneration, age time.Duration) {
+	timer := t.clock.NewTimer(age)
+	select {
+	case <-timer.C():
+	case <-generation.closed:
+		timer.Stop()
+		return
+	}
+	t.mu.Lock()
+	t.retireLocked(generation)
+	t.mu.Unlock()
+}
+
+// retireLocked stops a generation from being used for new requests. It must
+// be called with t.mu held.
+func (t *agingTransport) retireLocked(generation *transportGeneration) {
+	if t.current == generation {
+		t.current = nil
+	}
+	if !generation.retire() {
+		return
+	}
+	t.retired[generation] = struct{}{}
+	go t.drain(generation)
+}
+
+// drain closes a retired generation's idle connections right away, and the
+// rest once the requests using them finish or the grace period ends,
+// whichever comes first.
+func (t *agingTransport) drain(generation *transportGeneration) {
+	generation.transport.CloseIdleConnections()
+	generation.closeIfDrained()
+	if t.grace > 0 {
+		timer := t.clock.NewTimer(t.grace)
+		select {
+		case <-timer.C():
+		case <-generation.closed:
+			timer.Stop()
+		}
+	}
+	generation.close()
+	t.mu.Lock()
+	delete(t.retired, generation)
+	t.mu.Unlock()
+}
+
+// transportGeneration is a transport and the connections it has dialed.
+type transportGeneration struct {
+	transport *http.Transport
+	expires   time.Time
+	closed    chan struct{} // closed by the first call to close
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	active  int
+	retired bool
+	conns   map[net.Conn]struct{}
+}
+
+func newTransportGeneration(base *http.Transport, expires time.Time) *transportGeneration {
+	generation := &transportGeneration{
+		transport: base.Clone(),
+		expires:   expires,
+		closed:    make(chan struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	generation.transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tracked := &generationConn{Conn: conn, generation: generation}
+		generation.mu.Lock()
+		generation.conns[tracked] = struct{}{}
+		generation.mu.Unlock()
+		return tracked, nil
+	}
+	return generation
+}
+
+// retire marks the generation as retired. It reports false if the generation
+// was already retired.
+func (g *transportGeneration) retire() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.retired {
+		return false
+	}
+	g.retired = true
+	return true
+}
+
+func (g *transportGeneration) release() {
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+	g.closeIfDrained()
+}
+
+// closeIfDrained closes a retired generation that's no longer serving
+// requests.
+func (g *transportGeneration) closeIfDrained() {
+	g.mu.Lock()
+	drained := g.retired && g.active == 0
+	g.mu.Unlock()
+	if drained {
+		g.close()
+	}
+}
+
+// close closes every connection of the generation, whether or not it's
+// serving requests. Connections may still be on their way back to the
+// transport's idle pool, so they're closed directly rather than with
+// CloseIdleConnections.
+func (g *transportGeneration) close() {
+	g.mu.Lock()
+	conns := g.conns
+	g.conns = make(map[net.Conn]struct{})
+	g.mu.Unlock()
+	for conn := range conns {
+		_ = conn.Close()
+	}
+	g.transport.CloseIdleConnections()
+	g.closeOnce.Do(func() { close(g.closed) })
+}
+
+// generationBody releases its generation when the response is closed.
+type generationBody struct {
+	io.ReadCloser
+
+	generation *transportGeneration
+	once       sync.Once
+}
+
+func (b *generationBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.generation.release)
+	return err
+}
+
+// generationConn forgets itself when the transport closes it.
+type generationConn struct {
+	net.Conn
+
+	generation *transportGeneration
+}
+
+func (c *generationConn) Close() error {
+	c.generation.mu.Lock()
+	delete(c.generation.conns, c)
+	c.generation.mu.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,38 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+
+package connect
+
+import "net/http"
+
+// configureHTTP2 applies HTTP/2 settings, which net/http only exposes from Go
+// 1.24 onward.
+func configureHTTP2(transport *http.Transport, config *httpClientConfig) {
+	if config.HTTP2ConnWindowSize == 0 && config.HTTP2StreamWindowSize == 0 {
+		return
+	}
+	var http2 http.HTTP2Config
+	if transport.HTTP2 != nil {
+		http2 = *transport.HTTP2
+	}
+	if config.HTTP2ConnWindowSize != 0 {
+		http2.MaxReceiveBufferPerConnection = config.HTTP2ConnWindowSize
+	}
+	if config.HTTP2StreamWindowSize != 0 {
+		http2.MaxReceiveBufferPerStream = config.HTTP2StreamWindowSize
+	}
+	transport.HTTP2 = &http2
+}
@@ -0,0 +1,36 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+
+package connect
+
+import (
+	"net/http"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestNewHTTPClientWindowSizes(t *testing.T) {
+	t.Parallel()
+	transport, ok := NewHTTPClient(
+		WithHTTP2ConnWindowSize(2<<20),
+		WithHTTP2StreamWindowSize(1<<20),
+	).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.NotNil(t, transport.HTTP2)
+	assert.Equal(t, transport.HTTP2.MaxReceiveBufferPerConnection, 2<<20)
+	assert.Equal(t, transport.HTTP2.MaxReceiveBufferPerStream, 1<<20)
+}
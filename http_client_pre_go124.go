@@ -0,0 +1,23 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !go1.24
+
+package connect
+
+import "net/http"
+
+// configureHTTP2 is a no-op: before Go 1.24, net/http doesn't expose HTTP/2
+// settings, so the options that set them are ignored.
+func configureHTTP2(*http.Transport, *httpClientConfig) {}
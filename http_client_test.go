@@ -0,0 +1,336 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+	transport, ok := NewHTTPClient().Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.Proxy)
+	assert.Zero(t, transport.TLSClientConfig.ServerName)
+
+	transport, ok = NewHTTPClient(WithTLSServerName("example.com")).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, transport.TLSClientConfig.ServerName, "example.com")
+
+	// HTTP/2 window sizes are accepted on every Go version, even those that
+	// ignore them.
+	_, ok = NewHTTPClient(
+		WithHTTP2ConnWindowSize(2<<20),
+		WithHTTP2StreamWindowSize(1<<20),
+	).Transport.(*http.Transport)
+	assert.True(t, ok)
+}
+
+func TestDefaultGRPCClient(t *testing.T) {
+	t.Parallel()
+	client := DefaultGRPCClient()
+	assert.Zero(t, client.Timeout)
+	transport, ok := client.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.True(t, transport.DisableCompression)
+}
+
+func TestDoerFromHTTPClient(t *testing.T) {
+	t.Parallel()
+	original := &http.Client{Timeout: time.Minute}
+	adapted, ok := DoerFromHTTPClient(original).(*http.Client)
+	assert.True(t, ok)
+	assert.Nil(t, original.Transport)
+	assert.Equal(t, adapted.Timeout, time.Minute)
+	transport, ok := adapted.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.True(t, transport.DisableCompression)
+	assert.True(t, transport != http.DefaultTransport)
+
+	custom := &http.Client{Transport: roundTripperFunc(nil)}
+	assert.True(t, DoerFromHTTPClient(custom) == HTTPClient(custom))
+}
+
+func TestNewHTTPClientMaxConnAge(t *testing.T) {
+	t.Parallel()
+	server, conns := newCountingServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), false /* useTLS */)
+	get := func(client *http.Client) {
+		response, err := client.Get(server.URL)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+	}
+	clock := newManualClock()
+	client := NewHTTPClient(WithMaxConnAge(time.Hour, time.Minute), WithHTTPClientClock(clock))
+
+	get(client)
+	get(client)
+	assert.Equal(t, conns.dials.Load(), 1)
+	expiry := <-clock.timers
+	assert.True(t, expiry.delay >= 54*time.Minute && expiry.delay <= 66*time.Minute)
+	// Idle clients recycle their connections too.
+	expiry.fire()
+	<-clock.timers // grace period, unused since nothing's in flight
+	waitForCount(t, &conns.closes, 1)
+	get(client)
+	assert.Equal(t, conns.dials.Load(), 2)
+}
+
+func TestNewHTTPClientMaxConnAgeInFlight(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	server, conns := newCountingServer(t, newStreamingHandler(release), true /* useTLS */)
+	clock := newManualClock()
+	client := NewHTTPClient(
+		WithMaxConnAge(time.Hour, time.Hour),
+		WithHTTPClientClock(clock),
+		WithInsecureSkipVerify(),
+	)
+
+	stream := startStream(t, client, server.URL)
+	(<-clock.timers).fire()
+	<-clock.timers // grace period
+	// The stream's connection is too old for new requests, but not closed.
+	response, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, conns.dials.Load(), 2)
+	// Closing idle connections reaches both generations, but the stream's
+	// connection is busy.
+	client.CloseIdleConnections()
+	waitForCount(t, &conns.closes, 1)
+	// The stream finishes, and then its connection is closed.
+	close(release)
+	rest, err := io.ReadAll(stream.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, string(rest), "second")
+	assert.Nil(t, stream.Body.Close())
+	waitForCount(t, &conns.closes, 2)
+}
+
+func TestNewHTTPClientMaxConnAgeGrace(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	server, conns := newCountingServer(t, newStreamingHandler(release), true /* useTLS */)
+	clock := newManualClock()
+	client := NewHTTPClient(
+		WithMaxConnAge(time.Hour, time.Minute),
+		WithHTTPClientClock(clock),
+		WithInsecureSkipVerify(),
+	)
+
+	stream := startStream(t, client, server.URL)
+	(<-clock.timers).fire()
+	grace := <-clock.timers
+	assert.Equal(t, grace.delay, time.Minute)
+	assert.Zero(t, conns.closes.Load())
+	// Once the grace period is over, the stream is cut off, even though its
+	// body is never closed.
+	grace.fire()
+	waitForCount(t, &conns.closes, 1)
+	_, err := io.ReadAll(stream.Body)
+	assert.NotNil(t, err)
+}
+
+func TestNewHTTPClientInsecureSkipVerify(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	get := func(client *http.Client) error {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}
+
+	// httptest servers use self-signed certificates.
+	assert.NotNil(t, get(NewHTTPClient()))
+	assert.Nil(t, get(NewHTTPClient(WithInsecureSkipVerify())))
+
+	transport, ok := NewHTTPClient(
+		WithTLSServerName("example.com"),
+		WithInsecureSkipVerify(),
+	).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, transport.TLSClientConfig.ServerName, "example.com")
+}
+
+func TestNewHTTPClientRootCAs(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert} //nolint:gosec
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(path, certPEM, 0o600))
+	pool, err := CertPoolFromPEMFile(path)
+	assert.Nil(t, err)
+
+	// The httptest server's certificate is also usable as a client certificate.
+	clientCert := server.TLS.Certificates[0]
+	client := NewHTTPClient(
+		WithRootCAs(pool),
+		WithClientCertificates(clientCert),
+		WithTLSServerName("example.com"),
+	)
+	response, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusNoContent)
+
+	// Without the private CA, the server isn't trusted.
+	_, err = NewHTTPClient(WithClientCertificates(clientCert)).Get(server.URL)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+	_, err = CertPoolFromPEMFile(path)
+	assert.NotNil(t, err)
+	_, err = CertPoolFromPEMFile(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.NotNil(t, err)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// connCounts counts the connections a test server accepts and closes.
+type connCounts struct {
+	dials  atomic.Int32
+	closes atomic.Int32
+}
+
+// newCountingServer starts a test server that counts its connections and
+// closes it when the test ends. TLS servers support HTTP/2.
+func newCountingServer(tb testing.TB, handler http.Handler, useTLS bool) (*httptest.Server, *connCounts) {
+	tb.Helper()
+	conns := &connCounts{}
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state { //nolint:exhaustive
+		case http.StateNew:
+			conns.dials.Add(1)
+		case http.StateClosed:
+			conns.closes.Add(1)
+		}
+	}
+	if useTLS {
+		server.EnableHTTP2 = true
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	tb.Cleanup(server.Close)
+	return server, conns
+}
+
+// newStreamingHandler returns a handler that writes "first", waits for
+// release, and then writes "second" at /stream, and responds with no content
+// elsewhere.
+func newStreamingHandler(release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stream" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush() //nolint:forcetypeassert
+		<-release
+		_, _ = w.Write([]byte("second"))
+	})
+}
+
+// startStream requests /stream over HTTP/2 and reads the first part of the
+// response.
+func startStream(tb testing.TB, client *http.Client, url string) *http.Response {
+	tb.Helper()
+	stream, err := client.Get(url + "/stream")
+	assert.Nil(tb, err)
+	assert.Equal(tb, stream.ProtoMajor, 2)
+	first := make([]byte, len("first"))
+	_, err = io.ReadFull(stream.Body, first)
+	assert.Nil(tb, err)
+	return stream
+}
+
+// waitForCount waits for a connection count to reach want.
+func waitForCount(tb testing.TB, count *atomic.Int32, want int32) {
+	tb.Helper()
+	for i := 0; count.Load() < want && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(tb, count.Load(), want)
+}
+
+// manualClock hands its timers to the test, which fires them by hand.
+type manualClock struct {
+	systemClock
+
+	now    time.Time
+	timers chan *manualTimer
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(0, 0), timers: make(chan *manualTimer, 8)}
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	timer := &manualTimer{delay: d, c: make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer
+}
+
+type manualTimer struct {
+	delay time.Duration
+	c     chan time.Time
+}
+
+func (t *manualTimer) C() <-chan time.Time { return t.c }
+
+func (t *manualTimer) Stop() bool { return true }
+
+func (t *manualTimer) fire() { t.c <- time.Time{} }
@@ -0,0 +1,148 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyKeyHeader is the header that carries idempotency keys
+// unless clients and servers choose another. It follows the IETF draft for
+// HTTP idempotency keys.
+const DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// newIdempotencyKey returns a random key, unique for all practical purposes.
+func newIdempotencyKey() (string, error) {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key[:]), nil
+}
+
+// setIdempotencyKey adds a fresh key to the header.
+func setIdempotencyKey(header http.Header, name string) *Error {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return errorf(CodeInternal, "generate idempotency key: %w", err)
+	}
+	header.Set(name, key)
+	return nil
+}
+
+// NewServerDedupInterceptor returns a handler interceptor that rejects
+// requests repeating an idempotency key seen within the window. Clients
+// attach keys with [WithIdempotencyKeyHeader]; the header names on both sides
+// must match, and an empty header name means [DefaultIdempotencyKeyHeader].
+// Requests without a key pass through, and clients aren't affected by the
+// interceptor.
+//
+// Duplicates fail with [CodeAlreadyExists] while the original call is running
+// and after it succeeds. Keys of calls that fail are forgotten as soon as the
+// call returns, so clients may retry them. Keys are kept in memory, so they're
+// only deduplicated within a single process. The window is measured with the
+// handler's [Clock].
+func NewServerDedupInterceptor(header string, window time.Duration) Interceptor {
+	if header == "" {
+		header = DefaultIdempotencyKeyHeader
+	}
+	return &dedupInterceptor{
+		header: header,
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+type dedupInterceptor struct {
+	header string
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // key -> expiry
+	nextSweep time.Time
+}
+
+func (i *dedupInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		key := request.Header().Get(i.header)
+		if err := i.claim(clockFromContext(ctx), key); err != nil {
+			return nil, err
+		}
+		response, err := next(ctx, request)
+		if err != nil {
+			i.release(key)
+		}
+		return response, err
+	}
+}
+
+func (i *dedupInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *dedupInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		key := conn.RequestHeader().Get(i.header)
+		if err := i.claim(clockFromContext(ctx), key); err != nil {
+			return err
+		}
+		err := next(ctx, conn)
+		if err != nil {
+			i.release(key)
+		}
+		return err
+	}
+}
+
+// claim records the key, failing if it's already been seen within the window.
+func (i *dedupInterceptor) claim(clock Clock, key string) *Error {
+	if key == "" {
+		return nil
+	}
+	now := clock.Now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !now.Before(i.nextSweep) {
+		for seen, expiry := range i.seen {
+			if !now.Before(expiry) {
+				delete(i.seen, seen)
+			}
+		}
+		i.nextSweep = now.Add(i.window)
+	}
+	if expiry, ok := i.seen[key]; ok && now.Before(expiry) {
+		return NewError(CodeAlreadyExists, errors.New("duplicate idempotency key"))
+	}
+	i.seen[key] = now.Add(i.window)
+	return nil
+}
+
+func (i *dedupInterceptor) release(key string) {
+	if key == "" {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.seen, key)
+}
@@ -0,0 +1,43 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+	"time"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestDedupInterceptorWindow(t *testing.T) {
+	t.Parallel()
+	clock := &steppingClock{now: time.Unix(0, 0)}
+	interceptor, ok := NewServerDedupInterceptor("", time.Minute).(*dedupInterceptor)
+	assert.True(t, ok)
+
+	assert.Nil(t, interceptor.claim(clock, ""))
+	assert.Nil(t, interceptor.claim(clock, ""))
+	assert.Nil(t, interceptor.claim(clock, "a"))
+	assert.Equal(t, interceptor.claim(clock, "a").Code(), CodeAlreadyExists)
+	clock.now = clock.now.Add(30 * time.Second)
+	assert.Nil(t, interceptor.claim(clock, "b"))
+	assert.Equal(t, interceptor.claim(clock, "a").Code(), CodeAlreadyExists)
+	clock.now = clock.now.Add(30 * time.Second)
+	// The window for "a" has passed, and it's swept from memory.
+	assert.Nil(t, interceptor.claim(clock, "a"))
+	assert.Equal(t, len(interceptor.seen), 2)
+	interceptor.release("b")
+	assert.Nil(t, interceptor.claim(clock, "b"))
+}
@@ -103,3 +103,50 @@ func (c *chain) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandler
 	}
 	return next
 }
+
+// responseInterceptor is a client-side Interceptor that passes each received
+// message to a function before returning it to the caller.
+type responseInterceptor struct {
+	transform func(context.Context, Spec, any) error
+}
+
+func (i *responseInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		response, err := next(ctx, request)
+		if err != nil {
+			return response, err
+		}
+		if err := i.transform(ctx, request.Spec(), response.Any()); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func (i *responseInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &responseInterceptorConn{
+			StreamingClientConn: next(ctx, spec),
+			ctx:                 ctx,
+			transform:           i.transform,
+		}
+	}
+}
+
+func (i *responseInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+type responseInterceptorConn struct {
+	StreamingClientConn
+
+	ctx       context.Context //nolint:containedctx
+	transform func(context.Context, Spec, any) error
+}
+
+func (c *responseInterceptorConn) Receive(msg any) error {
+	if err := c.StreamingClientConn.Receive(msg); err != nil {
+		return err
+	}
+	return c.transform(c.ctx, c.Spec(), msg)
+}
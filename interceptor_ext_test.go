@@ -15,10 +15,14 @@
 package connect_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"sync/atomic"
 	"testing"
 
@@ -192,6 +196,71 @@ func TestEmptyUnaryInterceptorFunc(t *testing.T) {
 	assert.Nil(t, countUpStream.Close())
 }
 
+func TestResponseInterceptor(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	double := func(_ context.Context, _ connect.Spec, message any) error {
+		switch msg := message.(type) {
+		case *pingv1.PingResponse:
+			msg.Number *= 2
+		case *pingv1.CountUpResponse:
+			msg.Number *= 2
+		}
+		return nil
+	}
+	// Interceptors applied earlier are further out in the onion, so they see
+	// responses after the response interceptor.
+	outer := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			response, err := next(ctx, request)
+			if err == nil {
+				assert.Equal(t, response.Any().(*pingv1.PingResponse).GetNumber(), 42)
+			}
+			return response, err
+		}
+	})
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithInterceptors(outer),
+		connect.WithResponseInterceptor(double),
+	)
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 21}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+	})
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().GetNumber())
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, got, []int64{2, 4, 6})
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		failing := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithResponseInterceptor(func(context.Context, connect.Spec, any) error {
+				return connect.NewError(connect.CodeDataLoss, errors.New("can't decrypt"))
+			}),
+		)
+		_, err := failing.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDataLoss)
+		_, err = failing.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+}
+
 func TestInterceptorFuncAccessingHTTPMethod(t *testing.T) {
 	t.Parallel()
 	clientChecker := &httpMethodChecker{client: true}
@@ -395,3 +464,176 @@ func (h *httpMethodChecker) WrapStreamingHandler(handlerFunc connect.StreamingHa
 		return handlerFunc(ctx, conn)
 	}
 }
+
+func TestStreamValues(t *testing.T) {
+	t.Parallel()
+	type keyType struct{}
+	key := keyType{}
+	// The outer interceptor stashes a value that the inner interceptor reads,
+	// and vice versa.
+	outer := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			assert.Nil(t, connect.StreamValue(ctx, key))
+			ctx = connect.WithStreamValue(ctx, key, "outer")
+			response, err := next(ctx, request)
+			assert.Equal(t, connect.StreamValue(ctx, key), "inner")
+			return response, err
+		}
+	})
+	inner := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			assert.Equal(t, connect.StreamValue(ctx, key), "outer")
+			// Storing a value doesn't require a new context.
+			_ = connect.WithStreamValue(ctx, key, "inner")
+			return next(ctx, request)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(outer, inner),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithInterceptors(outer, inner),
+	)
+	// Values from the caller's context don't leak into the RPC's bag.
+	ctx := connect.WithStreamValue(context.Background(), key, "caller")
+	_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, connect.StreamValue(ctx, key), "caller")
+}
+
+func TestInterceptorRejectsStream(t *testing.T) {
+	t.Parallel()
+	// Interceptors reject streams before the handler runs by returning an
+	// error without calling next. Nothing has been sent, so gRPC responses are
+	// trailers-only and Connect responses carry just the end-of-stream message.
+	var handlerCalled atomic.Bool
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			countUp: func(context.Context, *connect.Request[pingv1.CountUpRequest], *connect.ServerStream[pingv1.CountUpResponse]) error {
+				handlerCalled.Store(true)
+				return nil
+			},
+		},
+		connect.WithInterceptors(&rejectingInterceptor{
+			err: connect.NewError(connect.CodePermissionDenied, errors.New("not allowed")),
+		}),
+	))
+	server := newHTTP2Server(t, mux)
+
+	for _, web := range []bool{false, true} {
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+pingv1connect.PingServiceCountUpProcedure,
+			bytes.NewReader([]byte{0, 0, 0, 0, 0}),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/grpc")
+		if web {
+			request.Header.Set("Content-Type", "application/grpc-web")
+		}
+		request.Header.Set("Te", "trailers")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		assert.Zero(t, len(body))
+		// gRPC-Web puts the status of trailers-only responses in the headers.
+		// net/http can't send gRPC's trailers-only HEADERS frame, so standard
+		// gRPC sends empty headers and then trailers, with no data between.
+		status := response.Trailer
+		if web {
+			status = response.Header
+		}
+		assert.Equal(t, status.Get("Grpc-Status"), strconv.Itoa(int(connect.CodePermissionDenied)))
+		assert.Equal(t, status.Get("Grpc-Message"), "not allowed")
+	}
+
+	for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodePermissionDenied)
+		assert.Nil(t, stream.Close())
+	}
+	assert.False(t, handlerCalled.Load())
+}
+
+// rejectingInterceptor fails every streaming RPC with err.
+type rejectingInterceptor struct {
+	err error
+}
+
+func (i *rejectingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return next
+}
+
+func (i *rejectingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *rejectingInterceptor) WrapStreamingHandler(connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(context.Context, connect.StreamingHandlerConn) error {
+		return i.err
+	}
+}
+
+func TestCodecName(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				return connect.NewResponse(&pingv1.PingResponse{Text: connect.CodecName(ctx)}), nil
+			},
+			countUp: func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				stream.ResponseHeader().Set("Codec", connect.CodecName(ctx))
+				return nil
+			},
+		},
+	))
+	server := newHTTP2Server(t, mux)
+
+	assert.Equal(t, connect.CodecName(context.Background()), "")
+	for _, protocol := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+		for _, codec := range []struct {
+			name string
+			opts []connect.ClientOption
+		}{
+			{"proto", nil},
+			{"json", []connect.ClientOption{connect.WithProtoJSON()}},
+		} {
+			var intercepted atomic.Int32
+			interceptor := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					assert.Equal(t, connect.CodecName(ctx), codec.name)
+					intercepted.Add(1)
+					return next(ctx, request)
+				}
+			})
+			opts := append([]connect.ClientOption{connect.WithInterceptors(interceptor)}, protocol...)
+			opts = append(opts, codec.opts...)
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetText(), codec.name)
+			assert.Equal(t, intercepted.Load(), 1)
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, stream.ResponseHeader().Get("Codec"), codec.name)
+			assert.Nil(t, stream.Close())
+		}
+	}
+}
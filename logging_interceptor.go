@@ -0,0 +1,231 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package connect
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// LoggingPolicy configures how the interceptor returned by
+// [NewLoggingInterceptor] logs a procedure.
+type LoggingPolicy struct {
+	// Disabled turns off logging for the procedure.
+	Disabled bool
+	// Level is the level of the record logged when an RPC succeeds. Failed
+	// RPCs are logged at [slog.LevelError], or at Level if it's higher.
+	Level slog.Level
+	// LogMessages adds the contents of Protobuf messages to the logs,
+	// rendered as JSON. For unary RPCs, the request and response are added
+	// to the RPC's record; streaming RPCs log a separate record for each
+	// message. Messages often contain sensitive data, so this is opt-in.
+	LogMessages bool
+	// Redact lists the fully-qualified names of fields to clear before
+	// logging messages, like "acme.user.v1.User.password". Redaction applies
+	// wherever the field appears, including in nested messages, lists, and
+	// maps.
+	Redact []protoreflect.FullName
+}
+
+// NewLoggingInterceptor returns a handler interceptor that logs each RPC's
+// procedure, code, and duration with log/slog, along with any error. Clients
+// aren't affected by the interceptor.
+//
+// The policy function chooses how to log each procedure, so content logging
+// and log levels may be enabled selectively. If policy is nil, every
+// procedure is logged at [slog.LevelInfo] without message contents.
+func NewLoggingInterceptor(logger *slog.Logger, policy func(Spec) LoggingPolicy) Interceptor {
+	if policy == nil {
+		policy = func(Spec) LoggingPolicy { return LoggingPolicy{Level: slog.LevelInfo} }
+	}
+	return &loggingInterceptor{logger: logger, policy: policy}
+}
+
+type loggingInterceptor struct {
+	logger *slog.Logger
+	policy func(Spec) LoggingPolicy
+}
+
+func (i *loggingInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		spec := request.Spec()
+		if spec.IsClient {
+			return next(ctx, request)
+		}
+		policy := i.policy(spec)
+		if policy.Disabled {
+			return next(ctx, request)
+		}
+		start := time.Now()
+		response, err := next(ctx, request)
+		attrs := []slog.Attr{}
+		if policy.LogMessages {
+			attrs = append(attrs, policy.messageAttr("request", request.Any()))
+			if response != nil {
+				attrs = append(attrs, policy.messageAttr("response", response.Any()))
+			}
+		}
+		i.logRPC(ctx, policy, spec, start, err, attrs)
+		return response, err
+	}
+}
+
+func (i *loggingInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *loggingInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		policy := i.policy(conn.Spec())
+		if policy.Disabled {
+			return next(ctx, conn)
+		}
+		start := time.Now()
+		if policy.LogMessages {
+			conn = &loggingHandlerConn{
+				StreamingHandlerConn: conn,
+				ctx:                  ctx,
+				logger:               i.logger,
+				policy:               policy,
+			}
+		}
+		err := next(ctx, conn)
+		i.logRPC(ctx, policy, conn.Spec(), start, err, nil)
+		return err
+	}
+}
+
+func (i *loggingInterceptor) logRPC(
+	ctx context.Context,
+	policy LoggingPolicy,
+	spec Spec,
+	start time.Time,
+	err error,
+	extra []slog.Attr,
+) {
+	level := policy.Level
+	code := "ok"
+	if err != nil {
+		code = CodeOf(err).String()
+		if level < slog.LevelError {
+			level = slog.LevelError
+		}
+	}
+	attrs := make([]slog.Attr, 0, 4+len(extra))
+	attrs = append(attrs,
+		slog.String("procedure", spec.Procedure),
+		slog.String("code", code),
+		slog.Duration("duration", time.Since(start)),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	attrs = append(attrs, extra...)
+	i.logger.LogAttrs(ctx, level, "rpc", attrs...)
+}
+
+// messageAttr renders a message as redacted JSON. Messages that aren't
+// Protobuf are logged as their type only.
+func (p *LoggingPolicy) messageAttr(key string, message any) slog.Attr {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return slog.String(key, fmt.Sprintf("<%T>", message))
+	}
+	if len(p.Redact) > 0 {
+		protoMessage = proto.Clone(protoMessage)
+		redactFields(protoMessage.ProtoReflect(), p.Redact)
+	}
+	data, err := protojson.Marshal(protoMessage)
+	if err != nil {
+		return slog.String(key, fmt.Sprintf("<can't marshal %T: %v>", message, err))
+	}
+	return slog.String(key, string(data))
+}
+
+// redactFields clears the named fields throughout the message.
+func redactFields(message protoreflect.Message, redact []protoreflect.FullName) {
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		for _, name := range redact {
+			if field.FullName() == name {
+				message.Clear(field)
+				return true
+			}
+		}
+		switch {
+		case field.IsMap():
+			if field.MapValue().Message() == nil {
+				return true
+			}
+			value.Map().Range(func(_ protoreflect.MapKey, entry protoreflect.Value) bool {
+				redactFields(entry.Message(), redact)
+				return true
+			})
+		case field.IsList():
+			if field.Message() == nil {
+				return true
+			}
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				redactFields(list.Get(i).Message(), redact)
+			}
+		case field.Message() != nil:
+			redactFields(value.Message(), redact)
+		}
+		return true
+	})
+}
+
+// loggingHandlerConn logs each message of a streaming RPC.
+type loggingHandlerConn struct {
+	StreamingHandlerConn
+
+	ctx    context.Context //nolint:containedctx
+	logger *slog.Logger
+	policy LoggingPolicy
+}
+
+func (c *loggingHandlerConn) Receive(msg any) error {
+	err := c.StreamingHandlerConn.Receive(msg)
+	if err == nil {
+		c.log("message received", "request", msg)
+	}
+	return err
+}
+
+func (c *loggingHandlerConn) Send(msg any) error {
+	err := c.StreamingHandlerConn.Send(msg)
+	if err == nil {
+		c.log("message sent", "response", msg)
+	}
+	return err
+}
+
+func (c *loggingHandlerConn) log(event, key string, msg any) {
+	c.logger.LogAttrs(
+		c.ctx,
+		c.policy.Level,
+		event,
+		slog.String("procedure", c.Spec().Procedure),
+		c.policy.messageAttr(key, msg),
+	)
+}
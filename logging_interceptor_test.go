@@ -0,0 +1,133 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Parallel()
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+	)
+	logger := slog.New(slog.NewJSONHandler(
+		&lockedWriter{mu: &mu, w: &out},
+		&slog.HandlerOptions{Level: slog.LevelDebug - 1},
+	))
+	interceptor := connect.NewLoggingInterceptor(logger, func(spec connect.Spec) connect.LoggingPolicy {
+		switch spec.Procedure {
+		case pingv1connect.PingServicePingProcedure, pingv1connect.PingServiceSumProcedure:
+			return connect.LoggingPolicy{
+				Level:       slog.LevelDebug - 1,
+				LogMessages: true,
+				Redact:      []protoreflect.FullName{"connect.ping.v1.PingRequest.text", "connect.ping.v1.PingResponse.text"},
+			}
+		case pingv1connect.PingServiceCountUpProcedure:
+			return connect.LoggingPolicy{Disabled: true}
+		default:
+			return connect.LoggingPolicy{Level: slog.LevelInfo}
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithInterceptors(interceptor)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	// Clients aren't logged.
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithInterceptors(interceptor))
+	records := func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var record map[string]any
+			assert.Nil(t, json.Unmarshal([]byte(line), &record), assert.Sprintf("line %q", line))
+			delete(record, "time")
+			delete(record, "duration")
+			records = append(records, record)
+		}
+		out.Reset()
+		return records
+	}
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "secret"}))
+	assert.Nil(t, err)
+	assert.Equal(t, records(), []map[string]any{{
+		"level":     "DEBUG-1",
+		"msg":       "rpc",
+		"procedure": pingv1connect.PingServicePingProcedure,
+		"code":      "ok",
+		"request":   `{"number":"42"}`,
+		"response":  `{"number":"42"}`,
+	}})
+
+	_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeNotFound)}))
+	assert.NotNil(t, err)
+	assert.Equal(t, records(), []map[string]any{{
+		"level":     "ERROR",
+		"msg":       "rpc",
+		"procedure": pingv1connect.PingServiceFailProcedure,
+		"code":      "not_found",
+		"error":     map[string]any{"code": "not_found", "message": errorMessage},
+	}})
+
+	stream := client.Sum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+	assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+	_, err = stream.CloseAndReceive()
+	assert.Nil(t, err)
+	assert.Equal(t, records(), []map[string]any{
+		{"level": "DEBUG-1", "msg": "message received", "procedure": pingv1connect.PingServiceSumProcedure, "request": `{"number":"1"}`},
+		{"level": "DEBUG-1", "msg": "message received", "procedure": pingv1connect.PingServiceSumProcedure, "request": `{"number":"2"}`},
+		{"level": "DEBUG-1", "msg": "message sent", "procedure": pingv1connect.PingServiceSumProcedure, "response": `{"sum":"3"}`},
+		{"level": "DEBUG-1", "msg": "rpc", "procedure": pingv1connect.PingServiceSumProcedure, "code": "ok"},
+	})
+
+	countUp, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+	assert.Nil(t, err)
+	_, err = countUp.ReceiveAll(0)
+	assert.Nil(t, err)
+	mu.Lock()
+	assert.Equal(t, out.Len(), 0)
+	mu.Unlock()
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(data)
+}
@@ -0,0 +1,185 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MethodConfigWildcard is the [WithMethodConfig] key for settings that apply
+// to every procedure without a more specific entry.
+const MethodConfigWildcard = "*"
+
+// MethodConfig holds a client's defaults for calls to a procedure, mirroring
+// the per-method settings in a gRPC service config. Zero values leave the
+// corresponding settings alone.
+type MethodConfig struct {
+	// Timeout bounds each call that doesn't already have an earlier deadline.
+	// For streaming calls, the timeout covers the whole stream.
+	Timeout time.Duration
+	// ReadMaxBytes and SendMaxBytes limit message sizes, like
+	// [WithReadMaxBytes] and [WithSendMaxBytes].
+	ReadMaxBytes int
+	SendMaxBytes int
+	// RetryPolicy configures retries, like [WithRetryPolicy].
+	RetryPolicy *RetryPolicy
+	// Options are any other options to apply, like compression settings.
+	// The fields above take precedence over them.
+	Options []ClientOption
+}
+
+// WithMethodConfig sets defaults for calls to particular procedures, so a
+// client for a service whose methods need different timeouts, limits, or
+// compression doesn't need per-call boilerplate. Generated clients pass the
+// same options to every method, and each method picks its own entry.
+//
+// Keys are fully-qualified procedure names, like
+// "/acme.foo.v1.FooService/Bar"; service-wide entries like
+// "/acme.foo.v1.FooService/*"; and [MethodConfigWildcard]. Only the most
+// specific matching entry applies: a procedure's own entry completely
+// replaces its service's entry, which in turn replaces the wildcard.
+//
+// Like other options, method configs apply in order, so options that follow
+// WithMethodConfig override its settings.
+func WithMethodConfig(configs map[string]MethodConfig) ClientOption {
+	return &methodConfigOption{Configs: configs}
+}
+
+type methodConfigOption struct {
+	Configs map[string]MethodConfig
+}
+
+func (o *methodConfigOption) applyToClient(config *clientConfig) {
+	methodConfig, ok := lookupMethodConfig(o.Configs, config.Procedure)
+	if !ok {
+		return
+	}
+	for _, option := range methodConfig.Options {
+		option.applyToClient(config)
+	}
+	if methodConfig.Timeout > 0 {
+		config.Timeout = methodConfig.Timeout
+	}
+	if methodConfig.ReadMaxBytes > 0 {
+		config.ReadMaxBytes = methodConfig.ReadMaxBytes
+	}
+	if methodConfig.SendMaxBytes > 0 {
+		config.SendMaxBytes = methodConfig.SendMaxBytes
+	}
+	if methodConfig.RetryPolicy != nil {
+		policy := *methodConfig.RetryPolicy
+		config.RetryPolicy = &policy
+	}
+}
+
+// lookupMethodConfig finds the most specific entry for the procedure.
+func lookupMethodConfig(configs map[string]MethodConfig, procedure string) (MethodConfig, bool) {
+	if config, ok := configs[procedure]; ok {
+		return config, true
+	}
+	if slash := strings.LastIndexByte(procedure, '/'); slash > 0 {
+		if config, ok := configs[procedure[:slash+1]+"*"]; ok {
+			return config, true
+		}
+	}
+	config, ok := configs[MethodConfigWildcard]
+	return config, ok
+}
+
+// timeoutClientConn releases a streaming call's timeout once the caller is
+// done with the response.
+type timeoutClientConn struct {
+	StreamingClientConn
+
+	cancel context.CancelFunc
+}
+
+func (c *timeoutClientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.cancel()
+	return err
+}
+
+// withClockTimeout is like [context.WithTimeout], but measures the timeout
+// with clock: the deadline is clock.Now()+timeout, and the context expires
+// when a timer from clock fires. That keeps protocol timeout headers, which
+// are computed with the same clock, consistent with when the call actually
+// times out.
+func withClockTimeout(ctx context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	deadline := clock.Now().Add(timeout)
+	if parent, ok := ctx.Deadline(); ok && !deadline.Before(parent) {
+		// The parent's deadline comes first.
+		return context.WithCancel(ctx)
+	}
+	timeoutCtx := &clockTimeoutContext{
+		Context:  ctx,
+		deadline: deadline,
+		done:     make(chan struct{}),
+	}
+	timer := clock.NewTimer(timeout)
+	go func() {
+		select {
+		case <-timer.C():
+			timeoutCtx.cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			timer.Stop()
+			timeoutCtx.cancel(ctx.Err())
+		case <-timeoutCtx.done:
+			timer.Stop()
+		}
+	}()
+	return timeoutCtx, func() { timeoutCtx.cancel(context.Canceled) }
+}
+
+// clockTimeoutContext is the context returned by withClockTimeout. It has its
+// own Done channel, rather than embedding a context from
+// [context.WithCancel], so that contexts derived from it report its error
+// instead of that of the embedded context.
+type clockTimeoutContext struct {
+	context.Context //nolint:containedctx
+
+	deadline time.Time
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *clockTimeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockTimeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *clockTimeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *clockTimeoutContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
@@ -0,0 +1,122 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// RPCInfo summarizes a finished RPC for the callback registered with
+// [WithOnFinish].
+type RPCInfo struct {
+	// Spec describes the RPC, including its procedure and whether the
+	// summary comes from a client or a handler.
+	Spec Spec
+	// Err is the RPC's error, or nil if it succeeded.
+	Err error
+	// Code is the code of Err, or zero if the RPC succeeded.
+	Code Code
+	// Duration runs from the start of the RPC until it finished.
+	Duration time.Duration
+	// BytesSent and BytesReceived count the bytes written to and read from
+	// the network, including envelopes and compression.
+	BytesSent     int64
+	BytesReceived int64
+	// Compression reports the sizes of the messages before and after
+	// compression.
+	Compression CompressionStats
+}
+
+func newRPCInfo(spec Spec, duration time.Duration, stats *streamStats, err error) RPCInfo {
+	info := RPCInfo{
+		Spec:          spec,
+		Err:           err,
+		Duration:      duration,
+		BytesSent:     stats.sent(),
+		BytesReceived: stats.received(),
+		Compression:   stats.compression(),
+	}
+	if err != nil {
+		info.Code = CodeOf(err)
+	}
+	return info
+}
+
+// onFinishClientConn reports a streaming call to an OnFinish callback. The
+// call finishes when Receive reaches the end of the stream or fails, or when
+// the caller closes the response, whichever comes first.
+type onFinishClientConn struct {
+	StreamingClientConn
+
+	onFinish func(RPCInfo)
+	clock    Clock
+	start    time.Time
+	stats    *streamStats
+
+	once  sync.Once
+	mu    sync.Mutex
+	err   error // first error other than io.EOF
+	ended bool  // Receive reached the end of the stream
+}
+
+func (c *onFinishClientConn) Send(msg any) error {
+	err := c.StreamingClientConn.Send(msg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		// An io.EOF means the server ended the stream, and Receive will
+		// report why.
+		c.record(err)
+	}
+	return err
+}
+
+func (c *onFinishClientConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if err != nil {
+		c.record(err)
+		c.finish()
+	}
+	return err
+}
+
+func (c *onFinishClientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.finish()
+	return err
+}
+
+func (c *onFinishClientConn) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errors.Is(err, io.EOF) {
+		c.ended = true
+	} else if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *onFinishClientConn) finish() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		err := c.err
+		if err == nil && !c.ended {
+			err = errorf(CodeCanceled, "response closed before the end of the stream")
+		}
+		c.mu.Unlock()
+		c.onFinish(newRPCInfo(c.Spec(), c.clock.Now().Sub(c.start), c.stats, err))
+	})
+}
@@ -19,6 +19,9 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // A ClientOption configures a [Client].
@@ -71,6 +74,32 @@ func WithGRPCWeb() ClientOption {
 	return &grpcOption{web: true}
 }
 
+// WithContentTypeOverride sets the exact Content-Type of requests from gRPC and
+// gRPC-Web clients, for interoperability with servers that insist on a
+// particular spelling. For example, some servers accept only
+// "application/grpc", while others require "application/grpc+proto".
+//
+// The override must be a gRPC content type when combined with [WithGRPC], or a
+// binary gRPC-Web content type when combined with [WithGRPCWeb], and it must
+// name the client's codec: the bare types imply Protobuf. Clients using the
+// Connect protocol can't override the content type. Invalid overrides make
+// every call fail with [CodeUnknown].
+//
+// By default, clients send the codec's name as a subtype, like
+// "application/grpc+proto".
+func WithContentTypeOverride(contentType string) ClientOption {
+	return &contentTypeOverrideOption{ContentType: contentType}
+}
+
+// WithoutGRPCTimeout stops gRPC and gRPC-Web clients from sending the
+// Grpc-Timeout header, for interoperability with servers and proxies that
+// mishandle it. The client still enforces the context's deadline locally, but
+// the server no longer learns it, so it may keep working on calls the client
+// has abandoned. Clients using the Connect protocol aren't affected.
+func WithoutGRPCTimeout() ClientOption {
+	return &withoutGRPCTimeoutOption{}
+}
+
 // WithProtoJSON configures a client to send JSON-encoded data instead of
 // binary Protobuf. It uses the standard Protobuf JSON mapping as implemented
 // by [google.golang.org/protobuf/encoding/protojson]: fields are named using
@@ -114,6 +143,13 @@ type HandlerOption interface {
 // supplied constructors must use the same algorithm. Internally, Connect pools
 // compressors and decompressors.
 //
+// Unary RPCs using the Connect protocol negotiate compression with the
+// standard HTTP Accept-Encoding and Content-Encoding headers, so browsers and
+// other plain HTTP clients can use any algorithm registered under its HTTP
+// content-coding name (for example, "br" for brotli). Streaming RPCs and the
+// gRPC protocols compress each message individually and negotiate using
+// protocol-specific headers.
+//
 // By default, handlers support gzip using the standard library's
 // [compress/gzip] package at the default compression level. To remove support for
 // a previously-registered compression algorithm, use WithCompression with nil
@@ -142,6 +178,14 @@ func WithHandlerOptions(options ...HandlerOption) HandlerOption {
 // client. It may also log the panic, emit metrics, or execute other
 // error-handling logic. Handler functions must be safe to call concurrently.
 //
+// The function runs on the panicking goroutine before the stack unwinds, so
+// [runtime/debug.Stack] captures the panic's stack trace for logging. Take
+// care not to send the panic value or stack to clients: returning an error
+// like NewError(CodeInternal, errors.New("internal error")) keeps those
+// details on the server. The function may also inspect the recovered value
+// and choose a more specific code. If it returns nil, the client receives
+// [CodeInternal].
+//
 // To preserve compatibility with [net/http]'s semantics, this interceptor
 // doesn't handle panics with [http.ErrAbortHandler].
 //
@@ -166,6 +210,103 @@ func WithRequireConnectProtocolHeader() HandlerOption {
 	return &requireConnectProtocolHeaderOption{}
 }
 
+// WithFirstMessageTimeout limits how long a Handler waits for the first
+// complete request message, counting from when the handler starts reading it
+// and measured with the Handler's [Clock] (see [WithClock]). Clients that send
+// headers and then dribble the body tie up a goroutine per RPC; with a
+// timeout, their RPCs fail with [CodeDeadlineExceeded] instead. Once the first
+// message arrives, later messages aren't limited, and any read deadline set by
+// the server (for example, from [http.Server.ReadTimeout]) still applies.
+//
+// On Go 1.20 and later, the timeout interrupts pending reads on both HTTP/1
+// and HTTP/2, as long as middleware wrapping the http.ResponseWriter supports
+// [http.ResponseController]. Otherwise, it only interrupts HTTP/2 reads.
+// Setting WithFirstMessageTimeout to zero, the default, disables the limit.
+func WithFirstMessageTimeout(timeout time.Duration) HandlerOption {
+	return &firstMessageTimeoutOption{Timeout: timeout}
+}
+
+// WithMaxHeaderBytes limits the total size of the request headers a Handler
+// accepts, counting the length of every header key and value. Requests with
+// larger headers are rejected with [CodeResourceExhausted] before the
+// procedure implementation or any interceptors run, which protects code that
+// copies metadata into memory.
+//
+// The HTTP server enforces its own, usually larger, limit (see
+// [http.Server.MaxHeaderBytes]) before the request reaches the Handler.
+// Setting WithMaxHeaderBytes to zero, the default, disables the check.
+func WithMaxHeaderBytes(max int) HandlerOption {
+	return &maxHeaderBytesOption{Max: max}
+}
+
+// WithGRPCMessageEscapes percent-encodes the given characters in the
+// Grpc-Message trailer, which carries error messages in the gRPC and gRPC-Web
+// protocols, in addition to the characters the gRPC specification requires.
+// Implementations disagree slightly on which printable ASCII characters to
+// escape, and some peers reject messages containing characters they'd have
+// escaped. For example, WithGRPCMessageEscapes(" ") escapes spaces.
+//
+// Control characters, non-ASCII bytes, and the percent sign itself are always
+// escaped. Every compliant client decodes any percent-encoded byte, so this
+// option doesn't affect interoperability with other peers.
+func WithGRPCMessageEscapes(chars string) HandlerOption {
+	return &grpcMessageEscapesOption{Chars: chars}
+}
+
+// WithGRPCStatusMarshalOptions sets the options used to marshal the
+// google.rpc.Status message that carries error details in the gRPC and
+// gRPC-Web protocols. For example, deterministic marshaling makes the
+// Grpc-Status-Details-Bin trailer reproducible, which helps golden tests and
+// caches:
+//
+//	connect.WithGRPCStatusMarshalOptions(proto.MarshalOptions{Deterministic: true})
+//
+// Error details are marshaled when they're created, so these options only
+// apply to the Status envelope. By default, handlers marshal the Status with
+// their Protobuf codec.
+func WithGRPCStatusMarshalOptions(options proto.MarshalOptions) HandlerOption {
+	return &grpcStatusMarshalOptionsOption{Options: options}
+}
+
+// FlushBehavior controls when streaming handlers flush response messages to
+// the network. See [WithFlushBehavior].
+type FlushBehavior int
+
+const (
+	// FlushPerMessage flushes after every message. Each message reaches the
+	// client as soon as it's sent, at the cost of a write (and, for HTTP/2, a
+	// DATA frame) per message. This is the default.
+	FlushPerMessage FlushBehavior = iota
+	// FlushOnClose only flushes when the handler returns. In between, net/http
+	// writes to the network whenever its internal buffers fill, so many small
+	// messages share writes and frames. Throughput improves, but messages (and
+	// the response headers) may wait in the buffer until it fills or the
+	// stream ends, so use this mode only when clients don't need to see each
+	// message promptly.
+	FlushOnClose
+)
+
+// WithFlushBehavior controls when streaming handlers flush response messages.
+// By default, handlers use [FlushPerMessage], which favors latency;
+// [FlushOnClose] favors throughput instead. Unary handlers send a single
+// message and always flush when they return.
+func WithFlushBehavior(behavior FlushBehavior) HandlerOption {
+	return &flushBehaviorOption{Behavior: behavior}
+}
+
+// WithErrorHTTPStatus overrides the HTTP status codes that unary Connect
+// handlers use for errors. By default, each [Code] maps to the status in the
+// Connect protocol specification. Connect clients only recognize errors in
+// responses with non-2xx statuses, so if the mapping returns anything other
+// than a 4xx or 5xx status, the handler uses the default instead.
+//
+// The gRPC and gRPC-Web protocols always send errors with a 200 status, and
+// streaming Connect RPCs report errors in the body, so the mapping doesn't
+// apply to them.
+func WithErrorHTTPStatus(mapping func(Code) int) HandlerOption {
+	return &errorHTTPStatusOption{Mapping: mapping}
+}
+
 // WithConditionalHandlerOptions allows procedures in the same service to have
 // different configurations: for example, one procedure may need a much larger
 // WithReadMaxBytes setting than the others.
@@ -202,6 +343,17 @@ func WithCodec(codec Codec) Option {
 	return &codecOption{Codec: codec}
 }
 
+// WithDisableCompression turns off compression entirely, overriding any
+// compressors configured with other options, regardless of their order.
+// Clients send uncompressed requests and advertise that they only accept
+// uncompressed responses; handlers send uncompressed responses regardless of
+// what the client accepts, and reject compressed requests with
+// [CodeUnimplemented]. It's useful when debugging or when CPU is scarcer than
+// network bandwidth.
+func WithDisableCompression() Option {
+	return &disableCompressionOption{}
+}
+
 // WithCompressMinBytes sets a minimum size threshold for compression:
 // regardless of compressor configuration, messages smaller than the configured
 // minimum are sent uncompressed.
@@ -230,6 +382,20 @@ func WithReadMaxBytes(max int) Option {
 	return &readMaxBytesOption{Max: max}
 }
 
+// WithReadMaxStreamBytes limits the total size of all the messages read from a
+// single stream, bounding the memory a handler or client might need if it
+// buffers every message. Unlike [WithReadMaxBytes], which applies to each
+// message, the limit is cumulative: once the messages received so far add up
+// to more than the limit, Receive returns an error with
+// [CodeResourceExhausted]. Sizes are measured after decompression.
+//
+// The limit applies to streaming RPCs in every protocol; use WithReadMaxBytes
+// to limit unary messages. Setting WithReadMaxStreamBytes to zero, the
+// default, allows streams of any size.
+func WithReadMaxStreamBytes(max int) Option {
+	return &readMaxStreamBytesOption{Max: max}
+}
+
 // WithSendMaxBytes prevents sending messages too large for the client/handler
 // to handle without significant performance overhead. For handlers, WithSendMaxBytes
 // limits the size of a message that the handler can respond with. For clients,
@@ -242,6 +408,23 @@ func WithSendMaxBytes(max int) Option {
 	return &sendMaxBytesOption{Max: max}
 }
 
+// WithMaxRecvMsgSize is [WithReadMaxBytes] under grpc-go's name, to ease
+// migrations from grpc-go.
+//
+// The defaults differ: grpc-go limits received messages to 4 MiB by default,
+// but Connect allows any size unless configured otherwise. To keep grpc-go's
+// behavior, use WithMaxRecvMsgSize(4 << 20).
+func WithMaxRecvMsgSize(bytes int) Option {
+	return WithReadMaxBytes(bytes)
+}
+
+// WithMaxSendMsgSize is [WithSendMaxBytes] under grpc-go's name, to ease
+// migrations from grpc-go. Like grpc-go, Connect allows sending messages of
+// any size by default.
+func WithMaxSendMsgSize(bytes int) Option {
+	return WithSendMaxBytes(bytes)
+}
+
 // WithIdempotency declares the idempotency of the procedure. This can determine
 // whether a procedure call can safely be retried, and may affect which request
 // modalities are allowed for a given procedure call.
@@ -272,6 +455,116 @@ func WithHTTPGet() ClientOption {
 	return &enableGet{}
 }
 
+// WithSendTimeout limits how long each Send on a client may block waiting
+// for the server to accept data. Sends block when HTTP flow control stops the
+// client from writing, typically because the server isn't reading the request
+// body fast enough. When a Send exceeds the timeout, it returns an error with
+// [CodeDeadlineExceeded].
+//
+// A timed-out Send may have written part of its message, and there's no way
+// to retract bytes that are already on the wire, so exceeding the timeout
+// always aborts the whole stream: subsequent Sends fail, and Receive returns
+// the same error. Use context deadlines to bound the duration of the whole
+// RPC.
+//
+// Setting WithSendTimeout to zero, the default, lets sends block until the
+// RPC's context is done.
+func WithSendTimeout(timeout time.Duration) ClientOption {
+	return &sendTimeoutOption{Timeout: timeout}
+}
+
+// WithReadLimitPerSecond throttles how fast a client reads responses, in bytes
+// per second. Throttling applies to the raw response body, including
+// envelopes and compressed data, so it never splits or corrupts messages:
+// Receive simply takes longer. Reads wait on the [Clock] and give up when the
+// RPC's context is done. A client that hasn't read for a while may read up to
+// one second's worth of bytes (and at least 512 bytes) at once before the
+// limit applies.
+//
+// Limiting the read rate is useful for sharing bandwidth and for controlled
+// replays. Because HTTP flow control pushes back on the server, it also keeps
+// a fast server from overwhelming a slow consumer. Setting
+// WithReadLimitPerSecond to zero, the default, disables throttling.
+func WithReadLimitPerSecond(bytes int) ClientOption {
+	return &readLimitPerSecondOption{Bytes: bytes}
+}
+
+// WithRetryPolicy configures how the client retries failed unary RPCs.
+// Streaming RPCs are never retried. Start from [DefaultRetryPolicy] for
+// sensible defaults:
+//
+//	policy := connect.DefaultRetryPolicy()
+//	policy.MaxAttempts = 5
+//	client := pingv1connect.NewPingServiceClient(
+//		http.DefaultClient,
+//		"https://api.acme.com",
+//		connect.WithRetryPolicy(policy),
+//	)
+//
+// By default, clients don't retry. Passing a zero RetryPolicy disables
+// retries set by earlier options.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return &retryPolicyOption{Policy: policy}
+}
+
+// WithIdempotencyKeyHeader makes the client attach a random idempotency key to
+// every unary call, in the named header. The key is generated once per call
+// and reused if the call is retried (see [WithRetryPolicy]), so a cooperating
+// server can recognize repeated attempts and avoid running a call that isn't
+// idempotent twice; [NewServerDedupInterceptor] is one such server. Keys the
+// caller sets on the request are kept. Generated keys aren't added to the
+// caller's [Request], so reusing a Request makes a new call with a new key.
+//
+// An empty header name means [DefaultIdempotencyKeyHeader].
+func WithIdempotencyKeyHeader(header string) ClientOption {
+	if header == "" {
+		header = DefaultIdempotencyKeyHeader
+	}
+	return &idempotencyKeyHeaderOption{Header: header}
+}
+
+// WithTransportErrorCode customizes how the client assigns codes to errors
+// from its HTTP transport, like failures to dial the server or complete a TLS
+// handshake. The mapping receives the error returned by the [HTTPClient]. The
+// default is [DefaultTransportErrorCode], which custom mappings can use as a
+// fallback:
+//
+//	connect.WithTransportErrorCode(func(err error) connect.Code {
+//		var certErr *tls.CertificateVerificationError
+//		if errors.As(err, &certErr) {
+//			return connect.CodeUnauthenticated
+//		}
+//		return connect.DefaultTransportErrorCode(err)
+//	})
+//
+// Because retry decisions are usually made by code, the mapping is also a
+// convenient way to control which transport failures are retried.
+func WithTransportErrorCode(mapping func(error) Code) ClientOption {
+	return &transportErrorCodeOption{Mapping: mapping}
+}
+
+// WithHeader adds a header to every request the client sends. Repeated uses
+// of WithHeader and [WithHeaders] accumulate, and headers set on individual
+// requests are added alongside them. It's useful for static metadata, like
+// API keys.
+//
+// Headers that the RPC protocols manage, like Content-Type and Grpc-Timeout,
+// are reserved. Using a reserved or malformed header makes every call from
+// the client fail.
+func WithHeader(key, value string) ClientOption {
+	return &headerOption{header: http.Header{http.CanonicalHeaderKey(key): []string{value}}}
+}
+
+// WithHeaders adds headers to every request the client sends. It behaves like
+// repeated calls to [WithHeader].
+func WithHeaders(header http.Header) ClientOption {
+	clone := make(http.Header, len(header))
+	for key, values := range header {
+		clone[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	return &headerOption{header: clone}
+}
+
 // WithInterceptors configures a client or handler's interceptor stack. Repeated
 // WithInterceptors options are applied in order, so
 //
@@ -323,6 +616,45 @@ func WithInterceptors(interceptors ...Interceptor) Option {
 	return &interceptorsOption{interceptors}
 }
 
+// WithOnFinish registers a callback that's called once for every RPC, after it
+// finishes, with a summary of the call. It's a lightweight alternative to an
+// interceptor for basic instrumentation.
+//
+// Handlers call it after the handler function returns and the response is
+// complete, and after rejecting requests they can't serve, like those with an
+// unsupported HTTP method, Content-Type, or compression. Unary clients call it
+// before returning the response. Streaming clients call it when Receive
+// reaches the end of the stream or fails, or when the response is closed,
+// whichever comes first; streams closed before reaching the end are reported
+// as [CodeCanceled]. Callbacks run synchronously, so they should be quick.
+func WithOnFinish(onFinish func(RPCInfo)) Option {
+	return &onFinishOption{OnFinish: onFinish}
+}
+
+// WithResponseInterceptor adds a client interceptor that passes each response
+// message to transform before it's returned to the caller. It's a simpler
+// alternative to a full [Interceptor] for message-focused logic, like
+// redacting fields or decrypting payloads: transform may modify the message
+// in place, and any error it returns is returned to the caller instead of the
+// message. Errors from the RPC itself are passed through without calling
+// transform.
+//
+// The interceptor joins the client's interceptor stack in the position the
+// option is applied, so it composes with [WithInterceptors] in order.
+func WithResponseInterceptor(transform func(ctx context.Context, spec Spec, message any) error) ClientOption {
+	return &interceptorsOption{[]Interceptor{&responseInterceptor{transform: transform}}}
+}
+
+// WithClock configures the [Clock] a client or handler uses to tell time.
+// It's primarily useful in tests, which can supply a fake clock to make
+// timeout and deadline handling deterministic.
+//
+// By default, clients and handlers use the system clock. Passing a nil Clock
+// restores the default.
+func WithClock(clock Clock) Option {
+	return &clockOption{Clock: clock}
+}
+
 // WithOptions composes multiple Options into one.
 func WithOptions(options ...Option) Option {
 	return &optionsOption{options}
@@ -389,6 +721,16 @@ func (o *compressionOption) apply(configuredNames *[]string, configuredPools map
 	*configuredNames = append(*configuredNames, o.Name)
 }
 
+type disableCompressionOption struct{}
+
+func (o *disableCompressionOption) applyToClient(config *clientConfig) {
+	config.DisableCompression = true
+}
+
+func (o *disableCompressionOption) applyToHandler(config *handlerConfig) {
+	config.DisableCompression = true
+}
+
 type compressMinBytesOption struct {
 	Min int
 }
@@ -413,6 +755,18 @@ func (o *readMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.ReadMaxBytes = o.Max
 }
 
+type readMaxStreamBytesOption struct {
+	Max int
+}
+
+func (o *readMaxStreamBytesOption) applyToClient(config *clientConfig) {
+	config.ReadMaxStreamBytes = o.Max
+}
+
+func (o *readMaxStreamBytesOption) applyToHandler(config *handlerConfig) {
+	config.ReadMaxStreamBytes = o.Max
+}
+
 type sendMaxBytesOption struct {
 	Max int
 }
@@ -441,6 +795,55 @@ func (o *requireConnectProtocolHeaderOption) applyToHandler(config *handlerConfi
 	config.RequireConnectProtocolHeader = true
 }
 
+type firstMessageTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *firstMessageTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.FirstMessageTimeout = o.Timeout
+}
+
+type maxHeaderBytesOption struct {
+	Max int
+}
+
+func (o *maxHeaderBytesOption) applyToHandler(config *handlerConfig) {
+	config.MaxHeaderBytes = o.Max
+}
+
+type grpcMessageEscapesOption struct {
+	Chars string
+}
+
+func (o *grpcMessageEscapesOption) applyToHandler(config *handlerConfig) {
+	config.GRPCMessageEscapes = o.Chars
+}
+
+type grpcStatusMarshalOptionsOption struct {
+	Options proto.MarshalOptions
+}
+
+func (o *grpcStatusMarshalOptionsOption) applyToHandler(config *handlerConfig) {
+	options := o.Options
+	config.GRPCStatusMarshalOptions = &options
+}
+
+type flushBehaviorOption struct {
+	Behavior FlushBehavior
+}
+
+func (o *flushBehaviorOption) applyToHandler(config *handlerConfig) {
+	config.FlushBehavior = o.Behavior
+}
+
+type errorHTTPStatusOption struct {
+	Mapping func(Code) int
+}
+
+func (o *errorHTTPStatusOption) applyToHandler(config *handlerConfig) {
+	config.ErrorHTTPStatus = o.Mapping
+}
+
 type idempotencyOption struct {
 	idempotencyLevel IdempotencyLevel
 }
@@ -461,6 +864,20 @@ func (o *grpcOption) applyToClient(config *clientConfig) {
 	config.Protocol = &protocolGRPC{web: o.web}
 }
 
+type contentTypeOverrideOption struct {
+	ContentType string
+}
+
+func (o *contentTypeOverrideOption) applyToClient(config *clientConfig) {
+	config.ContentTypeOverride = o.ContentType
+}
+
+type withoutGRPCTimeoutOption struct{}
+
+func (o *withoutGRPCTimeoutOption) applyToClient(config *clientConfig) {
+	config.OmitGRPCTimeout = true
+}
+
 type enableGet struct{}
 
 func (o *enableGet) applyToClient(config *clientConfig) {
@@ -499,6 +916,71 @@ func (o *getURLMaxBytes) applyToClient(config *clientConfig) {
 	config.GetUseFallback = o.Fallback
 }
 
+type sendTimeoutOption struct {
+	Timeout time.Duration
+}
+
+func (o *sendTimeoutOption) applyToClient(config *clientConfig) {
+	config.SendTimeout = o.Timeout
+}
+
+type readLimitPerSecondOption struct {
+	Bytes int
+}
+
+func (o *readLimitPerSecondOption) applyToClient(config *clientConfig) {
+	config.ReadLimitPerSecond = o.Bytes
+}
+
+type idempotencyKeyHeaderOption struct {
+	Header string
+}
+
+func (o *idempotencyKeyHeaderOption) applyToClient(config *clientConfig) {
+	config.IdempotencyKeyHeader = o.Header
+}
+
+type retryPolicyOption struct {
+	Policy RetryPolicy
+}
+
+func (o *retryPolicyOption) applyToClient(config *clientConfig) {
+	policy := o.Policy
+	policy.RetryableCodes = append([]Code(nil), o.Policy.RetryableCodes...)
+	config.RetryPolicy = &policy
+}
+
+type transportErrorCodeOption struct {
+	Mapping func(error) Code
+}
+
+func (o *transportErrorCodeOption) applyToClient(config *clientConfig) {
+	config.TransportErrorCode = o.Mapping
+}
+
+type headerOption struct {
+	header http.Header
+}
+
+func (o *headerOption) applyToClient(config *clientConfig) {
+	if config.Header == nil {
+		config.Header = make(http.Header, len(o.header))
+	}
+	mergeHeaders(config.Header, o.header)
+}
+
+type onFinishOption struct {
+	OnFinish func(RPCInfo)
+}
+
+func (o *onFinishOption) applyToClient(config *clientConfig) {
+	config.OnFinish = o.OnFinish
+}
+
+func (o *onFinishOption) applyToHandler(config *handlerConfig) {
+	config.OnFinish = o.OnFinish
+}
+
 type interceptorsOption struct {
 	Interceptors []Interceptor
 }
@@ -524,6 +1006,25 @@ func (o *interceptorsOption) chainWith(current Interceptor) Interceptor {
 	return newChain(append([]Interceptor{current}, o.Interceptors...))
 }
 
+type clockOption struct {
+	Clock Clock
+}
+
+func (o *clockOption) applyToClient(config *clientConfig) {
+	config.Clock = o.clock()
+}
+
+func (o *clockOption) applyToHandler(config *handlerConfig) {
+	config.Clock = o.clock()
+}
+
+func (o *clockOption) clock() Clock {
+	if o.Clock == nil {
+		return systemClock{}
+	}
+	return o.Clock
+}
+
 type optionsOption struct {
 	options []Option
 }
@@ -24,6 +24,9 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // The names of the Connect, gRPC, and gRPC-Web protocols (as exposed by
@@ -35,10 +38,13 @@ const (
 )
 
 const (
-	headerContentType = "Content-Type"
-	headerHost        = "Host"
-	headerUserAgent   = "User-Agent"
-	headerTrailer     = "Trailer"
+	headerContentType     = "Content-Type"
+	headerContentLength   = "Content-Length"
+	headerContentEncoding = "Content-Encoding"
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerHost            = "Host"
+	headerUserAgent       = "User-Agent"
+	headerTrailer         = "Trailer"
 
 	discardLimit = 1024 * 1024 * 4 // 4MiB
 )
@@ -77,9 +83,15 @@ type protocolHandlerParams struct {
 	CompressMinBytes             int
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
+	ReadMaxStreamBytes           int
 	SendMaxBytes                 int
 	RequireConnectProtocolHeader bool
 	IdempotencyLevel             IdempotencyLevel
+	Clock                        Clock
+	GRPCMessageEscapes           string
+	GRPCStatusMarshalOptions     *proto.MarshalOptions
+	FlushBehavior                FlushBehavior
+	ErrorHTTPStatus              func(Code) int
 }
 
 // Handler is the server side of a protocol. HTTP handlers typically support
@@ -105,8 +117,9 @@ type protocolHandler interface {
 	// be concerned with the content type/payload specifically.
 	CanHandlePayload(*http.Request, string) bool
 
-	// NewConn constructs a HandlerConn for the message exchange.
-	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, bool)
+	// NewConn constructs a HandlerConn for the message exchange. If it can't,
+	// it writes the error to the client and returns it.
+	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, error)
 }
 
 // ClientParams are the arguments provided to a Protocol's NewClient method,
@@ -114,18 +127,29 @@ type protocolHandler interface {
 // Protocol implementations should take care to use the supplied Spec rather
 // than constructing their own, since new fields may have been added.
 type protocolClientParams struct {
-	CompressionName  string
-	CompressionPools readOnlyCompressionPools
-	Codec            Codec
-	CompressMinBytes int
-	HTTPClient       HTTPClient
-	URL              *url.URL
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
-	EnableGet        bool
-	GetURLMaxBytes   int
-	GetUseFallback   bool
+	CompressionName    string
+	CompressionPools   readOnlyCompressionPools
+	Codec              Codec
+	CompressMinBytes   int
+	HTTPClient         HTTPClient
+	URL                *url.URL
+	BufferPool         *bufferPool
+	ReadMaxBytes       int
+	ReadMaxStreamBytes int
+	SendMaxBytes       int
+	EnableGet          bool
+	GetURLMaxBytes     int
+	GetUseFallback     bool
+	SendTimeout        time.Duration
+	ReadLimitPerSecond int
+	TransportErrorCode func(error) Code
+	Clock              Clock
+	// ContentType overrides the default request Content-Type. Only the gRPC
+	// family of protocols supports overrides.
+	ContentType string
+	// OmitGRPCTimeout stops the gRPC family of protocols from sending the
+	// context's deadline in the Grpc-Timeout header.
+	OmitGRPCTimeout bool
 	// The gRPC family of protocols always needs access to a Protobuf codec to
 	// marshal and unmarshal errors.
 	Protobuf Codec
@@ -349,12 +373,27 @@ func checkServerStreamsCanFlush(spec Spec, responseWriter http.ResponseWriter) *
 	return nil
 }
 
+// hasRequestStream reports whether the client may send more than one message
+// in the RPC. For unary and server streaming RPCs, handlers should stop
+// receiving after the first message.
+func hasRequestStream(spec Spec) bool {
+	return spec.StreamType&StreamTypeClient == StreamTypeClient
+}
+
 func flushResponseWriter(w http.ResponseWriter) {
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
 }
 
+// flushAfterSend flushes the response writer after a streaming handler sends
+// a message, unless the handler is configured to flush only on close.
+func (b FlushBehavior) flushAfterSend(w http.ResponseWriter) {
+	if b != FlushOnClose {
+		flushResponseWriter(w)
+	}
+}
+
 func canonicalizeContentType(contentType string) string {
 	// Typically, clients send Content-Type in canonical form, without
 	// parameters. In those cases, we'd like to avoid parsing and
@@ -34,8 +34,8 @@ import (
 )
 
 const (
-	connectUnaryHeaderCompression           = "Content-Encoding"
-	connectUnaryHeaderAcceptCompression     = "Accept-Encoding"
+	connectUnaryHeaderCompression           = headerContentEncoding
+	connectUnaryHeaderAcceptCompression     = headerAcceptEncoding
 	connectUnaryTrailerPrefix               = "Trailer-"
 	connectStreamingHeaderCompression       = "Connect-Content-Encoding"
 	connectStreamingHeaderAcceptCompression = "Connect-Accept-Encoding"
@@ -113,7 +113,7 @@ func (h *connectHandler) ContentTypes() map[string]struct{} {
 	return h.accept
 }
 
-func (*connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+func (h *connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout := getHeaderCanonical(request.Header, connectHeaderTimeout)
 	if timeout == "" {
 		return request.Context(), nil, nil
@@ -125,9 +125,9 @@ func (*connectHandler) SetTimeout(request *http.Request) (context.Context, conte
 	if err != nil {
 		return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(
+	ctx, cancel := context.WithDeadline(
 		request.Context(),
-		time.Duration(millis)*time.Millisecond,
+		h.Clock.Now().Add(time.Duration(millis)*time.Millisecond),
 	)
 	return ctx, cancel, nil
 }
@@ -148,7 +148,7 @@ func (h *connectHandler) CanHandlePayload(request *http.Request, contentType str
 func (h *connectHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, error) {
 	query := request.URL.Query()
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
@@ -189,6 +189,7 @@ func (h *connectHandler) NewConn(
 		}
 	}
 
+	stats := streamStatsFromContext(request.Context())
 	var requestBody io.ReadCloser
 	var contentType, codecName string
 	if request.Method == http.MethodGet {
@@ -206,7 +207,7 @@ func (h *connectHandler) NewConn(
 			codecName,
 		)
 	} else {
-		requestBody = request.Body
+		requestBody = countReads(request.Body, stats)
 		contentType = getHeaderCanonical(request.Header, headerContentType)
 		codecName = connectCodecFromContentType(
 			h.Spec.StreamType,
@@ -220,6 +221,9 @@ func (h *connectHandler) NewConn(
 	if failed == nil && codec == nil {
 		failed = errorf(CodeInvalidArgument, "invalid message encoding: %q", codecName)
 	}
+	if codec != nil {
+		codecNameFromContext(request.Context()).set(codec.Name())
+	}
 
 	// Write any remaining headers here:
 	// (1) any writes to the stream will implicitly send the headers, so we
@@ -251,12 +255,13 @@ func (h *connectHandler) NewConn(
 	}
 	if h.Spec.StreamType == StreamTypeUnary {
 		conn = &connectUnaryHandlerConn{
-			spec:           h.Spec,
-			peer:           peer,
-			request:        request,
-			responseWriter: responseWriter,
+			spec:            h.Spec,
+			peer:            peer,
+			request:         request,
+			responseWriter:  responseWriter,
+			errorHTTPStatus: h.ErrorHTTPStatus,
 			marshaler: connectUnaryMarshaler{
-				writer:           responseWriter,
+				writer:           countWrites(responseWriter, stats),
 				codec:            codec,
 				compressMinBytes: h.CompressMinBytes,
 				compressionName:  responseCompression,
@@ -264,6 +269,7 @@ func (h *connectHandler) NewConn(
 				bufferPool:       h.BufferPool,
 				header:           responseWriter.Header(),
 				sendMaxBytes:     h.SendMaxBytes,
+				setContentLength: true,
 			},
 			unmarshaler: connectUnaryUnmarshaler{
 				reader:          requestBody,
@@ -280,14 +286,16 @@ func (h *connectHandler) NewConn(
 			peer:           peer,
 			request:        request,
 			responseWriter: responseWriter,
+			flushBehavior:  h.FlushBehavior,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
-					writer:           responseWriter,
+					writer:           countWrites(responseWriter, stats),
 					codec:            codec,
 					compressMinBytes: h.CompressMinBytes,
 					compressionPool:  h.CompressionPools.Get(responseCompression),
 					bufferPool:       h.BufferPool,
 					sendMaxBytes:     h.SendMaxBytes,
+					stats:            stats,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
@@ -297,6 +305,8 @@ func (h *connectHandler) NewConn(
 					compressionPool: h.CompressionPools.Get(requestCompression),
 					bufferPool:      h.BufferPool,
 					readMaxBytes:    h.ReadMaxBytes,
+					readMaxStream:   h.ReadMaxStreamBytes,
+					stats:           stats,
 				},
 			},
 			responseTrailer: make(http.Header),
@@ -307,9 +317,9 @@ func (h *connectHandler) NewConn(
 	if failed != nil {
 		// Negotiation failed, so we can't establish a stream.
 		_ = conn.Close(failed)
-		return nil, false
+		return nil, failed
 	}
-	return conn, true
+	return conn, nil
 }
 
 type connectClient struct {
@@ -358,7 +368,7 @@ func (c *connectClient) NewConn(
 	header http.Header,
 ) streamingClientConn {
 	if deadline, ok := ctx.Deadline(); ok {
-		millis := int64(time.Until(deadline) / time.Millisecond)
+		millis := int64(c.Clock.Until(deadline) / time.Millisecond)
 		if millis > 0 {
 			encoded := strconv.FormatInt(millis, 10 /* base */)
 			if len(encoded) <= 10 {
@@ -366,7 +376,18 @@ func (c *connectClient) NewConn(
 			} // else effectively unbounded
 		}
 	}
+	compressionName := sendCompression(ctx, c.CompressionPools, c.CompressionName)
+	if spec.StreamType != StreamTypeUnary {
+		if compressionName != "" && compressionName != compressionIdentity {
+			header[connectStreamingHeaderCompression] = []string{compressionName}
+		} else {
+			delete(header, connectStreamingHeaderCompression)
+		}
+	}
 	duplexCall := newDuplexHTTPCall(ctx, c.HTTPClient, c.URL, spec, header)
+	duplexCall.SetSendTimeout(c.Clock, c.SendTimeout)
+	duplexCall.SetReadLimit(c.Clock, c.ReadLimitPerSecond)
+	duplexCall.transportErrorCode = c.TransportErrorCode
 	var conn streamingClientConn
 	if spec.StreamType == StreamTypeUnary {
 		unaryConn := &connectUnaryClientConn{
@@ -380,8 +401,8 @@ func (c *connectClient) NewConn(
 					writer:           duplexCall,
 					codec:            c.Codec,
 					compressMinBytes: c.CompressMinBytes,
-					compressionName:  c.CompressionName,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
+					compressionName:  compressionName,
+					compressionPool:  c.CompressionPools.Get(compressionName),
 					bufferPool:       c.BufferPool,
 					header:           duplexCall.Header(),
 					sendMaxBytes:     c.SendMaxBytes,
@@ -420,17 +441,20 @@ func (c *connectClient) NewConn(
 					writer:           duplexCall,
 					codec:            c.Codec,
 					compressMinBytes: c.CompressMinBytes,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
+					compressionPool:  c.CompressionPools.Get(compressionName),
 					bufferPool:       c.BufferPool,
 					sendMaxBytes:     c.SendMaxBytes,
+					stats:            duplexCall.stats,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
 				envelopeReader: envelopeReader{
-					reader:       duplexCall,
-					codec:        c.Codec,
-					bufferPool:   c.BufferPool,
-					readMaxBytes: c.ReadMaxBytes,
+					reader:        duplexCall,
+					codec:         c.Codec,
+					bufferPool:    c.BufferPool,
+					readMaxBytes:  c.ReadMaxBytes,
+					readMaxStream: c.ReadMaxStreamBytes,
+					stats:         duplexCall.stats,
 				},
 			},
 			responseHeader:  make(http.Header),
@@ -529,7 +553,9 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 		return serverErr
 	} else if response.StatusCode != http.StatusOK {
 		unmarshaler := connectUnaryUnmarshaler{
-			reader:          response.Body,
+			// The error body bypasses the duplex call's reads, so count it
+			// here.
+			reader:          countReads(response.Body, cc.duplexCall.stats),
 			compressionPool: cc.compressionPools.Get(compression),
 			bufferPool:      cc.bufferPool,
 		}
@@ -653,6 +679,10 @@ func (cc *connectStreamingClientConn) validateResponse(response *http.Response)
 		)
 	}
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	cc.duplexCall.accepted.set(parseAcceptCompression(
+		getHeaderCanonical(response.Header, connectStreamingHeaderAcceptCompression),
+		cc.compressionPools,
+	))
 	mergeHeaders(cc.responseHeader, response.Header)
 	return nil
 }
@@ -665,6 +695,7 @@ type connectUnaryHandlerConn struct {
 	marshaler       connectUnaryMarshaler
 	unmarshaler     connectUnaryUnmarshaler
 	responseTrailer http.Header
+	errorHTTPStatus func(Code) int
 	wroteBody       bool
 }
 
@@ -719,13 +750,16 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	}
 	// In unary Connect, errors always use application/json.
 	setHeaderCanonical(hc.responseWriter.Header(), headerContentType, connectUnaryContentTypeJSON)
-	hc.responseWriter.WriteHeader(connectCodeToHTTP(CodeOf(err)))
 	data, marshalErr := json.Marshal(newConnectWireError(err))
 	if marshalErr != nil {
+		hc.responseWriter.WriteHeader(connectErrorHTTPStatus(hc.errorHTTPStatus, CodeOf(err)))
 		_ = hc.request.Body.Close()
 		return errorf(CodeInternal, "marshal error: %w", err)
 	}
-	if _, writeErr := hc.responseWriter.Write(data); writeErr != nil {
+	setHeaderCanonical(hc.responseWriter.Header(), headerContentLength, strconv.Itoa(len(data)))
+	hc.responseWriter.WriteHeader(connectErrorHTTPStatus(hc.errorHTTPStatus, CodeOf(err)))
+	// Write through the marshaler's writer, which counts bytes sent.
+	if _, writeErr := hc.marshaler.writer.Write(data); writeErr != nil {
 		_ = hc.request.Body.Close()
 		return writeErr
 	}
@@ -759,9 +793,11 @@ type connectStreamingHandlerConn struct {
 	peer            Peer
 	request         *http.Request
 	responseWriter  http.ResponseWriter
+	flushBehavior   FlushBehavior
 	marshaler       connectStreamingMarshaler
 	unmarshaler     connectStreamingUnmarshaler
 	responseTrailer http.Header
+	receivedMessage bool
 }
 
 func (hc *connectStreamingHandlerConn) Spec() Spec {
@@ -773,11 +809,15 @@ func (hc *connectStreamingHandlerConn) Peer() Peer {
 }
 
 func (hc *connectStreamingHandlerConn) Receive(msg any) error {
+	if hc.receivedMessage && !hasRequestStream(hc.spec) {
+		return NewError(CodeUnknown, io.EOF)
+	}
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
 		// Clients may not send end-of-stream metadata, so we don't need to handle
 		// errSpecialEnvelope.
 		return err
 	}
+	hc.receivedMessage = true
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -786,7 +826,7 @@ func (hc *connectStreamingHandlerConn) RequestHeader() http.Header {
 }
 
 func (hc *connectStreamingHandlerConn) Send(msg any) error {
-	defer flushResponseWriter(hc.responseWriter)
+	defer hc.flushBehavior.flushAfterSend(hc.responseWriter)
 	if err := hc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
@@ -898,6 +938,9 @@ type connectUnaryMarshaler struct {
 	bufferPool       *bufferPool
 	header           http.Header
 	sendMaxBytes     int
+	// Handlers know the size of the single response message, so they can set
+	// Content-Length and spare clients from chunked transfer encoding.
+	setContentLength bool
 }
 
 func (m *connectUnaryMarshaler) Marshal(message any) *Error {
@@ -936,6 +979,9 @@ func (m *connectUnaryMarshaler) Marshal(message any) *Error {
 }
 
 func (m *connectUnaryMarshaler) write(data []byte) *Error {
+	if m.setContentLength {
+		m.header[headerContentLength] = []string{strconv.Itoa(len(data))}
+	}
 	if _, err := m.writer.Write(data); err != nil {
 		if connectErr, ok := asError(err); ok {
 			return connectErr
@@ -1203,6 +1249,18 @@ type connectEndStreamMessage struct {
 	Trailer http.Header       `json:"metadata,omitempty"`
 }
 
+// connectErrorHTTPStatus returns the HTTP status for an error with the given
+// code, consulting the user-supplied mapping first. Mappings that return
+// anything other than an error status fall back to the default.
+func connectErrorHTTPStatus(mapping func(Code) int, code Code) int {
+	if mapping != nil {
+		if status := mapping(code); status >= 400 && status <= 599 {
+			return status
+		}
+	}
+	return connectCodeToHTTP(code)
+}
+
 func connectCodeToHTTP(code Code) int {
 	// Return literals rather than named constants from the HTTP package to make
 	// it easier to compare this function to the Connect specification.
@@ -17,6 +17,7 @@ package connect
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"testing"
@@ -57,6 +58,65 @@ func TestConnectErrorDetailMarshalingNoDescriptor(t *testing.T) {
 	assert.Equal(t, string(encoded), raw)
 }
 
+func TestConnectWireErrorFixtures(t *testing.T) {
+	t.Parallel()
+	durationDetail, err := NewErrorDetail(durationpb.New(time.Second))
+	assert.Nil(t, err)
+	withDetail := NewError(CodeResourceExhausted, errors.New("slow down"))
+	withDetail.AddDetail(durationDetail)
+	// Error bodies as specified by the Connect protocol and produced by other
+	// implementations, like connect-es.
+	fixtures := []struct {
+		name string
+		json string
+		err  *Error
+	}{
+		{
+			name: "code_only",
+			json: `{"code":"unavailable"}`,
+			err:  NewError(CodeUnavailable, errors.New("")),
+		},
+		{
+			name: "message",
+			json: `{"code":"not_found","message":"no such user"}`,
+			err:  NewError(CodeNotFound, errors.New("no such user")),
+		},
+		{
+			name: "details",
+			json: `{"code":"resource_exhausted","message":"slow down","details":[` +
+				`{"type":"google.protobuf.Duration","value":"CAE",` +
+				`"debug":{"@type":"type.googleapis.com/google.protobuf.Duration","value":"1s"}}]}`,
+			err: withDetail,
+		},
+	}
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(fixture.name, func(t *testing.T) {
+			t.Parallel()
+			encoded, err := json.Marshal(newConnectWireError(fixture.err))
+			assert.Nil(t, err)
+			assert.Equal(t, string(encoded), fixture.json)
+
+			var wire connectWireError
+			assert.Nil(t, json.Unmarshal([]byte(fixture.json), &wire))
+			decoded := wire.asError()
+			assert.Equal(t, decoded.Code(), fixture.err.Code())
+			assert.Equal(t, decoded.Message(), fixture.err.Message())
+			assert.Equal(t, len(decoded.Details()), len(fixture.err.Details()))
+			for i, detail := range decoded.Details() {
+				assert.Equal(t, detail.Type(), fixture.err.Details()[i].Type())
+				assert.Equal(t, detail.Bytes(), fixture.err.Details()[i].Bytes())
+			}
+		})
+	}
+	t.Run("unknown_code", func(t *testing.T) {
+		t.Parallel()
+		var wire connectWireError
+		assert.Nil(t, json.Unmarshal([]byte(`{"code":"code_99","message":"oops"}`), &wire))
+		assert.Equal(t, wire.asError().Code(), CodeUnknown)
+	})
+}
+
 func TestConnectEndOfResponseCanonicalTrailers(t *testing.T) {
 	t.Parallel()
 
@@ -17,6 +17,7 @@ package connect
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -27,7 +28,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	statusv1 "connectrpc.com/connect/internal/gen/connectext/grpc/status/v1"
 )
@@ -45,10 +45,12 @@ const (
 	grpcTimeoutMaxHours = math.MaxInt64 / int64(time.Hour) // how many hours fit into a time.Duration?
 	grpcMaxTimeoutChars = 8                                // from gRPC protocol
 
-	grpcContentTypeDefault    = "application/grpc"
-	grpcWebContentTypeDefault = "application/grpc-web"
-	grpcContentTypePrefix     = grpcContentTypeDefault + "+"
-	grpcWebContentTypePrefix  = grpcWebContentTypeDefault + "+"
+	grpcContentTypeDefault        = "application/grpc"
+	grpcWebContentTypeDefault     = "application/grpc-web"
+	grpcWebTextContentTypeDefault = "application/grpc-web-text"
+	grpcContentTypePrefix         = grpcContentTypeDefault + "+"
+	grpcWebContentTypePrefix      = grpcWebContentTypeDefault + "+"
+	grpcWebTextContentTypePrefix  = grpcWebTextContentTypeDefault + "+"
 
 	headerXUserAgent = "X-User-Agent"
 )
@@ -102,9 +104,15 @@ func (g *protocolGRPC) NewHandler(params *protocolHandlerParams) protocolHandler
 	contentTypes := make(map[string]struct{})
 	for _, name := range params.Codecs.Names() {
 		contentTypes[canonicalizeContentType(prefix+name)] = struct{}{}
+		if g.web {
+			contentTypes[canonicalizeContentType(grpcWebTextContentTypePrefix+name)] = struct{}{}
+		}
 	}
 	if params.Codecs.Get(codecNameProto) != nil {
 		contentTypes[bare] = struct{}{}
+		if g.web {
+			contentTypes[grpcWebTextContentTypeDefault] = struct{}{}
+		}
 	}
 	return &grpcHandler{
 		protocolHandlerParams: *params,
@@ -141,7 +149,7 @@ func (g *grpcHandler) ContentTypes() map[string]struct{} {
 	return g.accept
 }
 
-func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+func (g *grpcHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout, err := grpcParseTimeout(getHeaderCanonical(request.Header, grpcHeaderTimeout))
 	if err != nil && !errors.Is(err, errNoTimeout) {
 		// Errors here indicate that the client sent an invalid timeout header, so
@@ -151,7 +159,7 @@ func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.
 		// err wraps errNoTimeout, nothing to do.
 		return request.Context(), nil, nil //nolint:nilerr
 	}
-	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	ctx, cancel := context.WithDeadline(request.Context(), g.Clock.Now().Add(timeout))
 	return ctx, cancel, nil
 }
 
@@ -163,7 +171,7 @@ func (g *grpcHandler) CanHandlePayload(request *http.Request, contentType string
 func (g *grpcHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, error) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	requestCompression, responseCompression, failed := negotiateCompression(
@@ -189,29 +197,52 @@ func (g *grpcHandler) NewConn(
 		header[grpcHeaderCompression] = []string{responseCompression}
 	}
 
-	codecName := grpcCodecFromContentType(g.web, getHeaderCanonical(request.Header, headerContentType))
+	contentType := getHeaderCanonical(request.Header, headerContentType)
+	codecName := grpcCodecFromContentType(g.web, contentType)
 	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	codecNameFromContext(request.Context()).set(codec.Name())
 	protocolName := ProtocolGRPC
 	if g.web {
 		protocolName = ProtocolGRPCWeb
 	}
+	stats := streamStatsFromContext(request.Context())
+	var (
+		writer io.Writer = countWrites(responseWriter, stats)
+		reader io.Reader = countReads(request.Body, stats)
+	)
+	if g.web && isGRPCWebText(contentType) {
+		// In gRPC-Web's text mode, the whole body (including the trailers
+		// envelope) is base64-encoded.
+		writer = &grpcWebTextWriter{writer: writer}
+		reader = &grpcWebTextReader{reader: reader}
+	}
+	flushBehavior := g.FlushBehavior
+	if g.Spec.StreamType == StreamTypeUnary {
+		// There's only one response message, so there's no reason to flush it
+		// separately: Close flushes it along with the trailers, which saves a
+		// write and usually an HTTP/2 DATA frame per call.
+		flushBehavior = FlushOnClose
+	}
 	conn := wrapHandlerConnWithCodedErrors(&grpcHandlerConn{
 		spec: g.Spec,
 		peer: Peer{
 			Addr:     request.RemoteAddr,
 			Protocol: protocolName,
 		},
-		web:        g.web,
-		bufferPool: g.BufferPool,
-		protobuf:   g.Codecs.Protobuf(), // for errors
+		web:            g.web,
+		bufferPool:     g.BufferPool,
+		protobuf:       withStatusMarshalOptions(g.Codecs.Protobuf(), g.GRPCStatusMarshalOptions), // for errors
+		messageEscapes: g.GRPCMessageEscapes,
+		flushBehavior:  flushBehavior,
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
-				writer:           responseWriter,
+				writer:           writer,
 				compressionPool:  g.CompressionPools.Get(responseCompression),
 				codec:            codec,
 				compressMinBytes: g.CompressMinBytes,
 				bufferPool:       g.BufferPool,
 				sendMaxBytes:     g.SendMaxBytes,
+				stats:            stats,
 			},
 		},
 		responseWriter:  responseWriter,
@@ -220,11 +251,13 @@ func (g *grpcHandler) NewConn(
 		request:         request,
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
-				reader:          request.Body,
+				reader:          reader,
 				codec:           codec,
 				compressionPool: g.CompressionPools.Get(requestCompression),
 				bufferPool:      g.BufferPool,
 				readMaxBytes:    g.ReadMaxBytes,
+				readMaxStream:   grpcReadMaxStream(g.Spec.StreamType, g.ReadMaxStreamBytes),
+				stats:           stats,
 			},
 			web: g.web,
 		},
@@ -232,9 +265,9 @@ func (g *grpcHandler) NewConn(
 	if failed != nil {
 		// Negotiation failed, so we can't establish a stream.
 		_ = conn.Close(failed)
-		return nil, false
+		return nil, failed
 	}
-	return conn, true
+	return conn, nil
 }
 
 type grpcClient struct {
@@ -261,11 +294,15 @@ func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 		// both.
 		header[headerXUserAgent] = []string{defaultGrpcUserAgent}
 	}
-	header[headerContentType] = []string{grpcContentTypeFromCodecName(g.web, g.Codec.Name())}
+	if g.ContentType != "" {
+		header[headerContentType] = []string{g.ContentType}
+	} else {
+		header[headerContentType] = []string{grpcContentTypeFromCodecName(g.web, g.Codec.Name())}
+	}
 	// gRPC handles compression on a per-message basis, so we don't want to
 	// compress the whole stream. By default, http.Client will ask the server
 	// to gzip the stream if we don't set Accept-Encoding.
-	header["Accept-Encoding"] = []string{compressionIdentity}
+	header[headerAcceptEncoding] = []string{compressionIdentity}
 	if g.CompressionName != "" && g.CompressionName != compressionIdentity {
 		header[grpcHeaderCompression] = []string{g.CompressionName}
 	}
@@ -284,12 +321,17 @@ func (g *grpcClient) NewConn(
 	spec Spec,
 	header http.Header,
 ) streamingClientConn {
-	if deadline, ok := ctx.Deadline(); ok {
-		if encodedDeadline, err := grpcEncodeTimeout(time.Until(deadline)); err == nil {
-			// Tests verify that the error in encodeTimeout is unreachable, so we
-			// don't need to handle the error case.
-			header[grpcHeaderTimeout] = []string{encodedDeadline}
-		}
+	if deadline, ok := ctx.Deadline(); ok && !g.OmitGRPCTimeout {
+		// Very distant deadlines may be clamped to the largest timeout the
+		// header can express. The client's context still enforces the true
+		// deadline.
+		header[grpcHeaderTimeout] = []string{grpcEncodeTimeout(g.Clock.Until(deadline))}
+	}
+	compressionName := sendCompression(ctx, g.CompressionPools, g.CompressionName)
+	if compressionName != "" && compressionName != compressionIdentity {
+		header[grpcHeaderCompression] = []string{compressionName}
+	} else {
+		delete(header, grpcHeaderCompression)
 	}
 	duplexCall := newDuplexHTTPCall(
 		ctx,
@@ -298,6 +340,9 @@ func (g *grpcClient) NewConn(
 		spec,
 		header,
 	)
+	duplexCall.SetSendTimeout(g.Clock, g.SendTimeout)
+	duplexCall.SetReadLimit(g.Clock, g.ReadLimitPerSecond)
+	duplexCall.transportErrorCode = g.TransportErrorCode
 	conn := &grpcClientConn{
 		spec:             spec,
 		peer:             g.Peer(),
@@ -308,19 +353,22 @@ func (g *grpcClient) NewConn(
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
 				writer:           duplexCall,
-				compressionPool:  g.CompressionPools.Get(g.CompressionName),
+				compressionPool:  g.CompressionPools.Get(compressionName),
 				codec:            g.Codec,
 				compressMinBytes: g.CompressMinBytes,
 				bufferPool:       g.BufferPool,
 				sendMaxBytes:     g.SendMaxBytes,
+				stats:            duplexCall.stats,
 			},
 		},
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
-				reader:       duplexCall,
-				codec:        g.Codec,
-				bufferPool:   g.BufferPool,
-				readMaxBytes: g.ReadMaxBytes,
+				reader:        duplexCall,
+				codec:         g.Codec,
+				bufferPool:    g.BufferPool,
+				readMaxBytes:  g.ReadMaxBytes,
+				readMaxStream: grpcReadMaxStream(spec.StreamType, g.ReadMaxStreamBytes),
+				stats:         duplexCall.stats,
 			},
 		},
 		responseHeader:  make(http.Header),
@@ -415,6 +463,13 @@ func (cc *grpcClientConn) Receive(msg any) error {
 	// This was probably an error converting the bytes to a message or an error
 	// reading from the network. We're going to return it to the
 	// user, but we also want to setResponseError so Send errors out.
+	if len(cc.responseTrailer) > 0 && !errors.Is(err, io.EOF) {
+		// Even without a status, trailers may carry diagnostics (like a request
+		// ID) that help explain the failure. End-of-stream errors may be shared
+		// between calls (see errSpecialEnvelope), so leave them alone.
+		err.meta = cc.responseHeader.Clone()
+		mergeHeaders(err.meta, cc.responseTrailer)
+	}
 	cc.duplexCall.SetError(err)
 	return err
 }
@@ -449,6 +504,10 @@ func (cc *grpcClientConn) validateResponse(response *http.Response) *Error {
 	}
 	compression := getHeaderCanonical(response.Header, grpcHeaderCompression)
 	cc.unmarshaler.envelopeReader.compressionPool = cc.compressionPools.Get(compression)
+	cc.duplexCall.accepted.set(parseAcceptCompression(
+		getHeaderCanonical(response.Header, grpcHeaderAcceptCompression),
+		cc.compressionPools,
+	))
 	return nil
 }
 
@@ -458,11 +517,14 @@ type grpcHandlerConn struct {
 	web             bool
 	bufferPool      *bufferPool
 	protobuf        Codec // for errors
+	messageEscapes  string
+	flushBehavior   FlushBehavior
 	marshaler       grpcMarshaler
 	responseWriter  http.ResponseWriter
 	responseHeader  http.Header
 	responseTrailer http.Header
 	wroteToBody     bool
+	receivedMessage bool
 	request         *http.Request
 	unmarshaler     grpcUnmarshaler
 }
@@ -476,9 +538,13 @@ func (hc *grpcHandlerConn) Peer() Peer {
 }
 
 func (hc *grpcHandlerConn) Receive(msg any) error {
+	if hc.receivedMessage && !hasRequestStream(hc.spec) {
+		return NewError(CodeUnknown, io.EOF)
+	}
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
 		return err // already coded
 	}
+	hc.receivedMessage = true
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -487,7 +553,7 @@ func (hc *grpcHandlerConn) RequestHeader() http.Header {
 }
 
 func (hc *grpcHandlerConn) Send(msg any) error {
-	defer flushResponseWriter(hc.responseWriter)
+	defer hc.flushBehavior.flushAfterSend(hc.responseWriter)
 	if !hc.wroteToBody {
 		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
 		hc.wroteToBody = true
@@ -532,7 +598,7 @@ func (hc *grpcHandlerConn) Close(err error) (retErr error) {
 		len(hc.responseTrailer)+2, // always make space for status & message
 	)
 	mergeHeaders(mergedTrailers, hc.responseTrailer)
-	grpcErrorToTrailer(mergedTrailers, hc.protobuf, err)
+	grpcErrorToTrailer(mergedTrailers, hc.protobuf, err, hc.messageEscapes)
 	if hc.web && !hc.wroteToBody {
 		// We're using gRPC-Web and we haven't yet written to the body. Since we're
 		// not sending any response messages, the gRPC specification calls this a
@@ -674,6 +740,23 @@ func grpcValidateResponse(
 	if response.StatusCode != http.StatusOK {
 		return errorf(grpcHTTPToCode(response.StatusCode), "HTTP status %v", response.Status)
 	}
+	// gRPC compresses individual messages. If the whole body is compressed,
+	// the envelopes are unreadable; if net/http transparently decompressed
+	// it, the response is no longer what the server sent and we can't trust
+	// its framing or Grpc-Encoding.
+	if response.Uncompressed {
+		return errorf(
+			CodeInternal,
+			"HTTP transport transparently decompressed the response: disable transport compression (for example, with http.Transport.DisableCompression)",
+		)
+	}
+	if encoding := getHeaderCanonical(response.Header, headerContentEncoding); encoding != "" && encoding != compressionIdentity {
+		return errorf(
+			CodeInternal,
+			"response body compressed with %q: gRPC compresses individual messages, so disable HTTP-level compression",
+			encoding,
+		)
+	}
 	if compression := getHeaderCanonical(response.Header, grpcHeaderCompression); compression != "" &&
 		compression != compressionIdentity &&
 		!availableCompressors.Contains(compression) {
@@ -795,33 +878,53 @@ func grpcParseTimeout(timeout string) (time.Duration, error) {
 	return time.Duration(num) * unit, nil
 }
 
-func grpcEncodeTimeout(timeout time.Duration) (string, error) {
+func grpcEncodeTimeout(timeout time.Duration) string {
 	if timeout <= 0 {
-		return "0n", nil
+		return "0n"
 	}
 	for _, pair := range grpcTimeoutUnits {
 		digits := strconv.FormatInt(int64(timeout/pair.size), 10 /* base */)
 		if len(digits) < grpcMaxTimeoutChars {
-			return digits + string(pair.char), nil
+			return digits + string(pair.char)
 		}
 	}
 	// The max time.Duration is smaller than the maximum expressible gRPC
-	// timeout, so we can't reach this case.
-	return "", errNoTimeout
+	// timeout, so we can't reach this case. If we could, the largest valid
+	// timeout would be better than an out-of-spec header that servers
+	// reject: the context still enforces the true deadline locally.
+	return strings.Repeat("9", grpcMaxTimeoutChars) + "H"
+}
+
+// grpcReadMaxStream returns the cumulative read limit for an RPC. gRPC frames
+// unary messages in envelopes too, but like the Connect protocol, the limit
+// only applies to streaming RPCs.
+func grpcReadMaxStream(streamType StreamType, readMaxStreamBytes int) int {
+	if streamType == StreamTypeUnary {
+		return 0
+	}
+	return readMaxStreamBytes
 }
 
 func grpcCodecFromContentType(web bool, contentType string) string {
-	if (!web && contentType == grpcContentTypeDefault) || (web && contentType == grpcWebContentTypeDefault) {
+	if (!web && contentType == grpcContentTypeDefault) ||
+		(web && (contentType == grpcWebContentTypeDefault || contentType == grpcWebTextContentTypeDefault)) {
 		// implicitly protobuf
 		return codecNameProto
 	}
 	prefix := grpcContentTypePrefix
-	if web {
+	if web && isGRPCWebText(contentType) {
+		prefix = grpcWebTextContentTypePrefix
+	} else if web {
 		prefix = grpcWebContentTypePrefix
 	}
 	return strings.TrimPrefix(contentType, prefix)
 }
 
+func isGRPCWebText(contentType string) bool {
+	return contentType == grpcWebTextContentTypeDefault ||
+		strings.HasPrefix(contentType, grpcWebTextContentTypePrefix)
+}
+
 func grpcContentTypeFromCodecName(web bool, name string) string {
 	if web {
 		return grpcWebContentTypePrefix + name
@@ -829,7 +932,9 @@ func grpcContentTypeFromCodecName(web bool, name string) string {
 	return grpcContentTypePrefix + name
 }
 
-func grpcErrorToTrailer(trailer http.Header, protobuf Codec, err error) {
+// grpcErrorToTrailer writes the error to the trailers. The message is
+// percent-encoded, also escaping any characters in extraEscapes.
+func grpcErrorToTrailer(trailer http.Header, protobuf Codec, err error, extraEscapes string) {
 	if err == nil {
 		setHeaderCanonical(trailer, grpcHeaderStatus, "0") // zero is the gRPC OK status
 		setHeaderCanonical(trailer, grpcHeaderMessage, "")
@@ -849,6 +954,7 @@ func grpcErrorToTrailer(trailer http.Header, protobuf Codec, err error) {
 			grpcHeaderMessage,
 			grpcPercentEncode(
 				fmt.Sprintf("marshal protobuf status: %v", binErr),
+				extraEscapes,
 			),
 		)
 		return
@@ -857,7 +963,7 @@ func grpcErrorToTrailer(trailer http.Header, protobuf Codec, err error) {
 		mergeHeaders(trailer, connectErr.meta)
 	}
 	setHeaderCanonical(trailer, grpcHeaderStatus, code)
-	setHeaderCanonical(trailer, grpcHeaderMessage, grpcPercentEncode(status.Message))
+	setHeaderCanonical(trailer, grpcHeaderMessage, grpcPercentEncode(status.Message, extraEscapes))
 	setHeaderCanonical(trailer, grpcHeaderDetails, EncodeBinaryHeader(bin))
 }
 
@@ -886,12 +992,13 @@ func grpcStatusFromError(err error) *statusv1.Status {
 //
 //	https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#responses
 //	https://datatracker.ietf.org/doc/html/rfc3986#section-2.1
-func grpcPercentEncode(msg string) string {
+//
+// Some peers are stricter than the spec, so callers may escape additional
+// characters by listing them in extraEscapes.
+func grpcPercentEncode(msg, extraEscapes string) string {
 	for i := 0; i < len(msg); i++ {
-		// Characters that need to be escaped are defined in gRPC's HTTP/2 spec.
-		// They're different from the generic set defined in RFC 3986.
-		if c := msg[i]; c < ' ' || c > '~' || c == '%' {
-			return grpcPercentEncodeSlow(msg, i)
+		if grpcShouldPercentEncode(msg[i], extraEscapes) {
+			return grpcPercentEncodeSlow(msg, extraEscapes, i)
 		}
 	}
 	return msg
@@ -899,13 +1006,13 @@ func grpcPercentEncode(msg string) string {
 
 // msg needs some percent-escaping. Bytes before offset don't require
 // percent-encoding, so they can be copied to the output as-is.
-func grpcPercentEncodeSlow(msg string, offset int) string {
+func grpcPercentEncodeSlow(msg, extraEscapes string, offset int) string {
 	var out strings.Builder
 	out.Grow(2 * len(msg))
 	out.WriteString(msg[:offset])
 	for i := offset; i < len(msg); i++ {
 		c := msg[i]
-		if c < ' ' || c > '~' || c == '%' {
+		if grpcShouldPercentEncode(c, extraEscapes) {
 			fmt.Fprintf(&out, "%%%02X", c)
 			continue
 		}
@@ -914,6 +1021,15 @@ func grpcPercentEncodeSlow(msg string, offset int) string {
 	return out.String()
 }
 
+func grpcShouldPercentEncode(c byte, extraEscapes string) bool {
+	// Characters that need to be escaped are defined in gRPC's HTTP/2 spec.
+	// They're different from the generic set defined in RFC 3986.
+	if c < ' ' || c > '~' || c == '%' {
+		return true
+	}
+	return extraEscapes != "" && strings.IndexByte(extraEscapes, c) >= 0
+}
+
 func grpcPercentDecode(encoded string) string {
 	for i := 0; i < len(encoded); i++ {
 		if c := encoded[i]; c == '%' && i+2 < len(encoded) {
@@ -924,7 +1040,9 @@ func grpcPercentDecode(encoded string) string {
 }
 
 // Similar to percentEncodeSlow: encoded is percent-encoded, and needs to be
-// decoded byte-by-byte starting at offset.
+// decoded byte-by-byte starting at offset. Buggy servers may send malformed
+// escapes, like "%ZZ" or a trailing "%"; we leave those as-is rather than
+// losing the rest of the message.
 func grpcPercentDecodeSlow(encoded string, offset int) string {
 	var out strings.Builder
 	out.Grow(len(encoded))
@@ -935,13 +1053,83 @@ func grpcPercentDecodeSlow(encoded string, offset int) string {
 			out.WriteByte(c)
 			continue
 		}
-		parsed, err := strconv.ParseUint(encoded[i+1:i+3], 16 /* hex */, 8 /* bitsize */)
-		if err != nil {
-			out.WriteRune(utf8.RuneError)
-		} else {
-			out.WriteByte(byte(parsed))
+		high, highOK := unhex(encoded[i+1])
+		low, lowOK := unhex(encoded[i+2])
+		if !highOK || !lowOK {
+			out.WriteByte(c)
+			continue
 		}
+		out.WriteByte(high<<4 | low)
 		i += 2
 	}
 	return out.String()
 }
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// grpcWebTextWriter base64-encodes everything written to it. Each write is
+// encoded and padded independently, so every flushed write is complete on the
+// wire; gRPC-Web clients must accept concatenated padded segments.
+type grpcWebTextWriter struct {
+	writer io.Writer
+}
+
+func (w *grpcWebTextWriter) Write(data []byte) (int, error) {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	if _, err := w.writer.Write(encoded); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// grpcWebTextReader base64-decodes everything read from it. Since clients may
+// send concatenated padded segments, it decodes each 4-byte quantum
+// separately.
+type grpcWebTextReader struct {
+	reader  io.Reader
+	encoded [4 * 256]byte
+	pending int    // bytes in encoded not yet decoded
+	decoded []byte // bytes decoded but not yet returned
+	err     error
+}
+
+func (r *grpcWebTextReader) Read(data []byte) (int, error) {
+	for len(r.decoded) == 0 {
+		if r.err != nil {
+			if errors.Is(r.err, io.EOF) && r.pending > 0 {
+				return 0, fmt.Errorf("base64: %w", io.ErrUnexpectedEOF)
+			}
+			return 0, r.err
+		}
+		n, err := r.reader.Read(r.encoded[r.pending:])
+		r.pending += n
+		r.err = err
+		complete := r.pending - r.pending%4
+		decoded := make([]byte, 0, complete/4*3)
+		for i := 0; i < complete; i += 4 {
+			var quantum [3]byte
+			size, decodeErr := base64.StdEncoding.Decode(quantum[:], r.encoded[i:i+4])
+			if decodeErr != nil {
+				r.err = fmt.Errorf("base64: %w", decodeErr)
+				break
+			}
+			decoded = append(decoded, quantum[:size]...)
+		}
+		r.decoded = decoded
+		r.pending = copy(r.encoded[:], r.encoded[complete:r.pending])
+	}
+	n := copy(data, r.decoded)
+	r.decoded = r.decoded[n:]
+	return n, nil
+}
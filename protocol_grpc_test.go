@@ -19,6 +19,7 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"testing/quick"
@@ -27,6 +28,8 @@ import (
 
 	"connectrpc.com/connect/internal/assert"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestGRPCHandlerSender(t *testing.T) {
@@ -119,22 +122,24 @@ func TestGRPCParseTimeout(t *testing.T) {
 
 func TestGRPCEncodeTimeout(t *testing.T) {
 	t.Parallel()
-	timeout, err := grpcEncodeTimeout(time.Hour + time.Second)
+	assert.Equal(t, grpcEncodeTimeout(time.Hour+time.Second), "3601000m")
+	assert.Equal(t, grpcEncodeTimeout(time.Duration(math.MaxInt64)), "2562047H")
+	assert.Equal(t, grpcEncodeTimeout(-1*time.Hour), "0n")
+	// Deadlines years away still fit in the header's eight digits.
+	tenYears := 10 * 365 * 24 * time.Hour
+	timeout := grpcEncodeTimeout(tenYears)
+	assert.Equal(t, timeout, "5256000M")
+	assert.True(t, len(timeout) <= grpcMaxTimeoutChars+1)
+	decoded, err := grpcParseTimeout(timeout)
 	assert.Nil(t, err)
-	assert.Equal(t, timeout, "3601000m")
-	timeout, err = grpcEncodeTimeout(time.Duration(math.MaxInt64))
-	assert.Nil(t, err)
-	assert.Equal(t, timeout, "2562047H")
-	timeout, err = grpcEncodeTimeout(-1 * time.Hour)
-	assert.Nil(t, err)
-	assert.Equal(t, timeout, "0n")
+	assert.Equal(t, decoded, tenYears)
 }
 
 func TestGRPCEncodeTimeoutQuick(t *testing.T) {
 	t.Parallel()
-	// Ensure that the error case is actually unreachable.
+	// Ensure that every duration encodes to a timeout servers accept.
 	encode := func(d time.Duration) bool {
-		_, err := grpcEncodeTimeout(d)
+		_, err := grpcParseTimeout(grpcEncodeTimeout(d))
 		return err == nil
 	}
 	if err := quick.Check(encode, nil); err != nil {
@@ -148,7 +153,7 @@ func TestGRPCPercentEncodingQuick(t *testing.T) {
 		if !utf8.ValidString(input) {
 			return true
 		}
-		encoded := grpcPercentEncode(input)
+		encoded := grpcPercentEncode(input, "")
 		decoded := grpcPercentDecode(encoded)
 		return decoded == input
 	}
@@ -161,7 +166,7 @@ func TestGRPCPercentEncoding(t *testing.T) {
 	t.Parallel()
 	roundtrip := func(input string) {
 		assert.True(t, utf8.ValidString(input), assert.Sprintf("input invalid UTF-8"))
-		encoded := grpcPercentEncode(input)
+		encoded := grpcPercentEncode(input, "")
 		t.Logf("%q encoded as %q", input, encoded)
 		decoded := grpcPercentDecode(encoded)
 		assert.Equal(t, decoded, input)
@@ -171,6 +176,39 @@ func TestGRPCPercentEncoding(t *testing.T) {
 	roundtrip("foo bar")
 	roundtrip(`foo%bar`)
 	roundtrip("fiancée")
+
+	// Extra escapes are encoded along with the characters the spec requires.
+	encoded := grpcPercentEncode("foo bar: 100%", " :")
+	assert.Equal(t, encoded, "foo%20bar%3A%20100%25")
+	assert.Equal(t, grpcPercentDecode(encoded), "foo bar: 100%")
+}
+
+func TestGRPCPercentDecodingMalformed(t *testing.T) {
+	t.Parallel()
+	for encoded, want := range map[string]string{
+		"%":             "%",
+		"%A":            "%A",
+		"%ZZ":           "%ZZ",
+		"100%":          "100%",
+		"50%A":          "50%A",
+		"%G1%41":        "%G1A",
+		"%4":            "%4",
+		"%4%41":         "%4A",
+		"%%41":          "%A",
+		"a%2Gb%20c":     "a%2Gb c",
+		"fianc%C3%A9e%": "fiancée%",
+		"%+1%-1%_1":     "%+1%-1%_1",
+	} {
+		assert.Equal(t, grpcPercentDecode(encoded), want, assert.Sprintf("decoding %q", encoded))
+	}
+	// Messages are never lost entirely, even if they're nothing but malformed
+	// escapes.
+	err := grpcErrorFromTrailer(&protoBinaryCodec{}, http.Header{
+		grpcHeaderStatus:  []string{"14"},
+		grpcHeaderMessage: []string{"%ZZ"},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Message(), "%ZZ")
 }
 
 func TestGRPCWebTrailerMarshalling(t *testing.T) {
@@ -193,12 +231,67 @@ func TestGRPCWebTrailerMarshalling(t *testing.T) {
 	assert.Equal(t, marshalled, "grpc-message: Foo\r\ngrpc-status: 0\r\nuser-provided: bar\r\n")
 }
 
+func TestGRPCValidateResponseTransportCompression(t *testing.T) {
+	t.Parallel()
+	pools := newReadOnlyCompressionPools(nil, nil)
+	validate := func(response *http.Response) *Error {
+		response.StatusCode = http.StatusOK
+		return grpcValidateResponse(response, http.Header{}, http.Header{}, pools, &protoBinaryCodec{})
+	}
+	header := http.Header{headerContentType: []string{grpcContentTypeDefault}}
+	assert.Nil(t, validate(&http.Response{Header: header}))
+	header.Set("Content-Encoding", compressionIdentity)
+	assert.Nil(t, validate(&http.Response{Header: header}))
+
+	err := validate(&http.Response{Header: header, Uncompressed: true})
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeInternal)
+	assert.True(t, strings.Contains(err.Message(), "DisableCompression"))
+
+	header.Set("Content-Encoding", compressionGzip)
+	err = validate(&http.Response{Header: header})
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeInternal)
+}
+
+func TestGRPCStatusMarshalOptions(t *testing.T) {
+	t.Parallel()
+	err := NewError(CodeUnavailable, errors.New("oops"))
+	detail, detailErr := NewErrorDetail(&emptypb.Empty{})
+	assert.Nil(t, detailErr)
+	err.AddDetail(detail)
+	status := grpcStatusFromError(err)
+	want, marshalErr := proto.MarshalOptions{Deterministic: true}.Marshal(status)
+	assert.Nil(t, marshalErr)
+
+	// Without options, the handler's Protobuf codec marshals the status.
+	codec := &failingCodec{}
+	trailer := http.Header{}
+	grpcErrorToTrailer(trailer, withStatusMarshalOptions(codec, nil), err, "")
+	assert.Equal(t, trailer.Get(grpcHeaderStatus), strconv.Itoa(int(CodeInternal)))
+
+	trailer = http.Header{}
+	options := &proto.MarshalOptions{Deterministic: true}
+	grpcErrorToTrailer(trailer, withStatusMarshalOptions(codec, options), err, "")
+	assert.Equal(t, trailer.Get(grpcHeaderStatus), strconv.Itoa(int(CodeUnavailable)))
+	assert.Equal(t, trailer.Get(grpcHeaderDetails), EncodeBinaryHeader(want))
+}
+
+// failingCodec is a Protobuf codec that can't marshal anything.
+type failingCodec struct {
+	protoBinaryCodec
+}
+
+func (c *failingCodec) Marshal(any) ([]byte, error) {
+	return nil, errors.New("can't marshal")
+}
+
 func BenchmarkGRPCPercentEncoding(b *testing.B) {
 	input := "Hello, 世界"
 	want := "Hello, %E4%B8%96%E7%95%8C"
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		got := grpcPercentEncode(input)
+		got := grpcPercentEncode(input, "")
 		if got != want {
 			b.Fatalf("encodeGrpcMessage(%q) = %s, want %s", input, got, want)
 		}
@@ -0,0 +1,106 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+const (
+	// minReadLimitGrant is the size of an envelope prefix.
+	minReadLimitGrant = 5
+	// minReadLimitBurst is the smallest burst a readLimiter allows, so very
+	// low limits don't degrade into a stream of tiny reads.
+	minReadLimitBurst = 512
+)
+
+// readLimiter is a token bucket over bytes. The bucket holds about one
+// second's worth of bytes, so a client that has been idle can read that much
+// in a burst before it's throttled to the steady rate.
+//
+// Only one goroutine reads a response body at a time, so readLimiter isn't
+// safe for concurrent use.
+type readLimiter struct {
+	clock          Clock
+	bytesPerSecond int
+	tokens         float64
+	last           time.Time
+}
+
+func newReadLimiter(clock Clock, bytesPerSecond int) *readLimiter {
+	limiter := &readLimiter{
+		clock:          clock,
+		bytesPerSecond: bytesPerSecond,
+		last:           clock.Now(),
+	}
+	limiter.tokens = float64(limiter.capacity())
+	return limiter
+}
+
+// wait blocks until the bucket holds tokens for a read of up to want bytes,
+// or until the context is done. It returns the number of bytes the caller
+// may read, which may be less than want. It never grants less than an
+// envelope prefix, though, since envelope readers expect the whole prefix
+// from a single Read.
+func (l *readLimiter) wait(ctx context.Context, want int) (int, error) {
+	need := want
+	if need > minReadLimitGrant {
+		need = minReadLimitGrant
+	}
+	for {
+		l.refill()
+		missing := float64(need) - l.tokens
+		if missing <= 0 {
+			break
+		}
+		delay := time.Duration(math.Ceil(missing / float64(l.bytesPerSecond) * float64(time.Second)))
+		timer := l.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+	if tokens := int(l.tokens); want > tokens {
+		return tokens, nil
+	}
+	return want, nil
+}
+
+// consume removes the bytes actually read from the bucket.
+func (l *readLimiter) consume(n int) {
+	l.tokens -= float64(n)
+}
+
+// capacity is the most the bucket holds: one second's worth of bytes, but
+// never less than minReadLimitBurst.
+func (l *readLimiter) capacity() int {
+	if l.bytesPerSecond < minReadLimitBurst {
+		return minReadLimitBurst
+	}
+	return l.bytesPerSecond
+}
+
+func (l *readLimiter) refill() {
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.bytesPerSecond)
+	if capacity := float64(l.capacity()); l.tokens > capacity {
+		l.tokens = capacity
+	}
+	l.last = now
+}
@@ -0,0 +1,92 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestReadLimiter(t *testing.T) {
+	t.Parallel()
+	t.Run("throttles", func(t *testing.T) {
+		t.Parallel()
+		clock := &steppingClock{now: time.Unix(0, 0)}
+		limiter := newReadLimiter(clock, 1000)
+		ctx := context.Background()
+
+		// The bucket starts full, and reads are capped at its capacity.
+		allowed, err := limiter.wait(ctx, 5000)
+		assert.Nil(t, err)
+		assert.Equal(t, allowed, 1000)
+		limiter.consume(600)
+
+		// Reads get whatever's left without waiting.
+		allowed, err = limiter.wait(ctx, 600)
+		assert.Nil(t, err)
+		assert.Equal(t, allowed, 400)
+		assert.Zero(t, len(clock.waits))
+		limiter.consume(allowed)
+
+		// Once the bucket is empty, reads wait for at least an envelope
+		// prefix's worth of tokens.
+		allowed, err = limiter.wait(ctx, 600)
+		assert.Nil(t, err)
+		assert.Equal(t, allowed, minReadLimitGrant)
+		assert.Equal(t, clock.waits, []time.Duration{5 * time.Millisecond})
+	})
+	t.Run("minimum_burst", func(t *testing.T) {
+		t.Parallel()
+		limiter := newReadLimiter(&steppingClock{now: time.Unix(0, 0)}, 10)
+		allowed, err := limiter.wait(context.Background(), 5000)
+		assert.Nil(t, err)
+		assert.Equal(t, allowed, minReadLimitBurst)
+	})
+	t.Run("context", func(t *testing.T) {
+		t.Parallel()
+		limiter := newReadLimiter(&steppingClock{now: time.Unix(0, 0), stalled: true}, 10)
+		limiter.consume(minReadLimitBurst)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := limiter.wait(ctx, 10)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+// steppingClock advances time by each timer's duration and fires it
+// immediately, unless it's stalled, in which case timers never fire.
+type steppingClock struct {
+	systemClock
+
+	now     time.Time
+	stalled bool
+	waits   []time.Duration
+}
+
+func (c *steppingClock) Now() time.Time { return c.now }
+
+func (c *steppingClock) NewTimer(d time.Duration) Timer {
+	c.waits = append(c.waits, d)
+	timer := make(chan time.Time, 1)
+	if !c.stalled {
+		c.now = c.now.Add(d)
+		timer <- c.now
+	}
+	return &recordingTimer{c: timer}
+}
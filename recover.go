@@ -16,6 +16,7 @@ package connect
 
 import (
 	"context"
+	"errors"
 	"net/http"
 )
 
@@ -51,7 +52,7 @@ func (i *recoverHandlerInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
 				if r == http.ErrAbortHandler { //nolint:errorlint,goerr113
 					panic(r) //nolint:forbidigo
 				}
-				retErr = i.handle(ctx, req.Spec(), req.Header(), r)
+				retErr = i.recovered(ctx, req.Spec(), req.Header(), r)
 			}
 		}()
 		res, err := next(ctx, req)
@@ -70,7 +71,7 @@ func (i *recoverHandlerInterceptor) WrapStreamingHandler(next StreamingHandlerFu
 				if r == http.ErrAbortHandler { //nolint:errorlint,goerr113
 					panic(r) //nolint:forbidigo
 				}
-				retErr = i.handle(ctx, Spec{}, nil, r)
+				retErr = i.recovered(ctx, conn.Spec(), conn.RequestHeader(), r)
 			}
 		}()
 		err := next(ctx, conn)
@@ -78,3 +79,11 @@ func (i *recoverHandlerInterceptor) WrapStreamingHandler(next StreamingHandlerFu
 		return err
 	}
 }
+
+func (i *recoverHandlerInterceptor) recovered(ctx context.Context, spec Spec, header http.Header, r any) error {
+	if err := i.handle(ctx, spec, header, r); err != nil {
+		return err
+	}
+	// Returning nil would report success for an RPC that didn't finish.
+	return NewError(CodeInternal, errors.New("internal error"))
+}
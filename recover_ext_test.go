@@ -19,6 +19,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
 
 	connect "connectrpc.com/connect"
@@ -106,3 +109,45 @@ func TestWithRecover(t *testing.T) {
 	assert.Nil(t, err)
 	assertNotHandled(drainStream(stream))
 }
+
+func TestWithRecoverDetails(t *testing.T) {
+	t.Parallel()
+	var (
+		mu     sync.Mutex
+		specs  []connect.Spec
+		stacks []string
+	)
+	handle := func(_ context.Context, spec connect.Spec, header http.Header, _ any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		specs = append(specs, spec)
+		stacks = append(stacks, string(debug.Stack()))
+		assert.NotZero(t, header.Get("Content-Type"))
+		return nil
+	}
+	pinger := &panicPingServer{panicWith: "secret"}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pinger, connect.WithRecover(handle)))
+	server := newHTTP2Server(t, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	assert.False(t, strings.Contains(err.Error(), "secret"))
+
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.False(t, stream.Receive())
+	assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInternal)
+	assert.Nil(t, stream.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, len(specs), 2)
+	assert.Equal(t, specs[0].Procedure, pingv1connect.PingServicePingProcedure)
+	assert.Equal(t, specs[1].Procedure, pingv1connect.PingServiceCountUpProcedure)
+	for _, stack := range stacks {
+		assert.True(t, strings.Contains(stack, "panicPingServer"))
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter selects how a [RetryPolicy] randomizes backoff. Randomizing
+// backoff spreads out the retries of many clients that failed at the same
+// time, so they don't overwhelm a recovering server all at once.
+type Jitter int
+
+const (
+	// JitterFull waits a random duration between zero and the computed
+	// backoff. It's the zero value, and it's the best choice for most
+	// clients.
+	JitterFull Jitter = iota
+	// JitterEqual waits half the computed backoff, plus a random duration
+	// up to the other half.
+	JitterEqual
+	// JitterNone waits exactly the computed backoff.
+	JitterNone
+)
+
+// RetryPolicy configures how a client retries failed unary RPCs. Retries
+// happen below the interceptor chain, so interceptors see a single call no
+// matter how many attempts it takes.
+//
+// Before the nth retry, the client waits for InitialBackoff *
+// BackoffMultiplier^(n-1), capped at MaxBackoff and randomized according to
+// Jitter. Retries stop as soon as the call's context is done.
+//
+// Retrying a call that isn't idempotent may run it more than once. Calls that
+// fail because the server refused the request before processing it are
+// retried regardless of RetryableCodes.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the original
+	// request. Values less than two disable retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// BackoffMultiplier grows the wait after each attempt. Values less than
+	// one are treated as one.
+	BackoffMultiplier float64
+	// Jitter randomizes the wait between attempts.
+	Jitter Jitter
+	// RetryableCodes lists the codes that make a failed attempt eligible for
+	// retry.
+	RetryableCodes []Code
+	// Rand returns pseudo-random numbers in [0.0, 1.0) for jitter. If nil,
+	// the client uses the math/rand package. Tests can supply a seeded source
+	// to make backoff deterministic.
+	Rand func() float64
+}
+
+// DefaultRetryPolicy returns a conservative policy: up to three attempts,
+// backing off from 100 milliseconds to at most one second with full jitter,
+// retrying only calls that fail with [CodeUnavailable].
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    100 * time.Millisecond,
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2,
+		Jitter:            JitterFull,
+		RetryableCodes:    []Code{CodeUnavailable},
+	}
+}
+
+// IsRetryable reports whether a call that failed with err may succeed if
+// tried again, for callers that write their own retry loops. Errors with one
+// of the given codes are retryable; if no codes are given, only
+// [CodeUnavailable] is. Calls the server refused before processing them are
+// always retryable, whatever their code, since the server never saw them.
+//
+// Errors caused by the caller's own context ending are never retryable,
+// since every further attempt would fail the same way. Only pass codes like
+// [CodeResourceExhausted] or [CodeAborted] for calls that are safe to repeat.
+func IsRetryable(err error, codes ...Code) bool {
+	if len(codes) == 0 {
+		codes = []Code{CodeUnavailable}
+	}
+	return isRetryable(err, codes)
+}
+
+func isRetryable(err error, codes []Code) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isTransparentlyRetryable(err) {
+		return true
+	}
+	code := CodeOf(err)
+	for _, retryable := range codes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) enabled() bool {
+	return p != nil && p.MaxAttempts > 1
+}
+
+// shouldRetry reports whether a call that failed with err after the given
+// number of attempts may be tried again.
+func (p *RetryPolicy) shouldRetry(attempts int, err error) bool {
+	if !p.enabled() || attempts >= p.MaxAttempts {
+		return false
+	}
+	return isRetryable(err, p.RetryableCodes)
+}
+
+// backoff returns the wait before the given retry, counting from one.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := math.Max(p.BackoffMultiplier, 1)
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	switch p.Jitter {
+	case JitterNone:
+	case JitterEqual:
+		wait = wait/2 + p.random()*wait/2
+	default:
+		wait *= p.random()
+	}
+	return time.Duration(wait)
+}
+
+func (p *RetryPolicy) random() float64 {
+	if p.Rand != nil {
+		return p.Rand()
+	}
+	return rand.Float64() //nolint:gosec // jitter doesn't need a secure source
+}
+
+// retryUnary calls attempt until it succeeds or the policy stops retrying,
+// waiting between attempts on the supplied clock.
+func retryUnary(
+	ctx context.Context,
+	policy *RetryPolicy,
+	clock Clock,
+	attempt func() (AnyResponse, error),
+) (AnyResponse, error) {
+	for attempts := 1; ; attempts++ {
+		response, err := attempt()
+		if !policy.shouldRetry(attempts, err) || ctx.Err() != nil {
+			return response, err
+		}
+		if wait := policy.backoff(attempts); wait > 0 {
+			timer := clock.NewTimer(wait)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, wrapIfContextError(ctx.Err())
+			}
+		}
+	}
+}
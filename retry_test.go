@@ -0,0 +1,189 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+	backoffs := func(policy RetryPolicy, retries int) []time.Duration {
+		var waits []time.Duration
+		for retry := 1; retry <= retries; retry++ {
+			waits = append(waits, policy.backoff(retry))
+		}
+		return waits
+	}
+	policy := RetryPolicy{
+		InitialBackoff:    100 * time.Millisecond,
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2,
+		Jitter:            JitterNone,
+	}
+	assert.Equal(t, backoffs(policy, 6), []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	})
+	// Jittered backoff is reproducible with a seeded source.
+	seeded := func(policy RetryPolicy) []time.Duration {
+		policy.Rand = rand.New(rand.NewSource(1)).Float64 //nolint:gosec
+		return backoffs(policy, 6)
+	}
+	policy.Jitter = JitterFull
+	full := seeded(policy)
+	assert.Equal(t, seeded(policy), full)
+	policy.Jitter = JitterEqual
+	equal := seeded(policy)
+	assert.Equal(t, seeded(policy), equal)
+	random := rand.New(rand.NewSource(1)) //nolint:gosec
+	for i, limit := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		limit *= time.Millisecond
+		fraction := random.Float64()
+		assert.Equal(t, full[i], time.Duration(float64(limit)*fraction))
+		assert.Equal(t, equal[i], time.Duration(float64(limit)/2+fraction*float64(limit)/2))
+		assert.True(t, full[i] < limit)
+		assert.True(t, equal[i] >= limit/2 && equal[i] < limit)
+	}
+}
+
+func TestRetryUnary(t *testing.T) {
+	t.Parallel()
+	unavailable := NewError(CodeUnavailable, errors.New("unavailable"))
+	// failing returns an attempt func that fails the first n calls with err.
+	failing := func(n int, err error) (func() (AnyResponse, error), *int) {
+		var calls int
+		return func() (AnyResponse, error) {
+			calls++
+			if calls <= n {
+				return nil, err
+			}
+			return NewResponse(&struct{}{}), nil
+		}, &calls
+	}
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 4
+	policy.Jitter = JitterNone
+	t.Run("succeeds_after_backoff", func(t *testing.T) {
+		t.Parallel()
+		clock := &recordingClock{}
+		attempt, calls := failing(3, unavailable)
+		_, err := retryUnary(context.Background(), &policy, clock, attempt)
+		assert.Nil(t, err)
+		assert.Equal(t, *calls, 4)
+		assert.Equal(t, clock.waits, []time.Duration{
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			400 * time.Millisecond,
+		})
+	})
+	t.Run("exhausts_attempts", func(t *testing.T) {
+		t.Parallel()
+		attempt, calls := failing(10, unavailable)
+		_, err := retryUnary(context.Background(), &policy, &recordingClock{}, attempt)
+		assert.Equal(t, CodeOf(err), CodeUnavailable)
+		assert.Equal(t, *calls, 4)
+	})
+	t.Run("non_retryable_code", func(t *testing.T) {
+		t.Parallel()
+		attempt, calls := failing(10, NewError(CodeInternal, errors.New("internal")))
+		_, err := retryUnary(context.Background(), &policy, &recordingClock{}, attempt)
+		assert.Equal(t, CodeOf(err), CodeInternal)
+		assert.Equal(t, *calls, 1)
+	})
+	t.Run("refused_stream", func(t *testing.T) {
+		t.Parallel()
+		refused := NewError(CodeUnknown, errors.New("refused"))
+		refused.transparentRetry = true
+		attempt, calls := failing(1, refused)
+		_, err := retryUnary(context.Background(), &policy, &recordingClock{}, attempt)
+		assert.Nil(t, err)
+		assert.Equal(t, *calls, 2)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		attempt, calls := failing(10, unavailable)
+		_, err := retryUnary(context.Background(), &RetryPolicy{}, &recordingClock{}, attempt)
+		assert.Equal(t, CodeOf(err), CodeUnavailable)
+		assert.Equal(t, *calls, 1)
+	})
+	t.Run("context_done", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempt, calls := failing(10, unavailable)
+		_, err := retryUnary(ctx, &policy, &recordingClock{}, attempt)
+		assert.Equal(t, CodeOf(err), CodeUnavailable)
+		assert.Equal(t, *calls, 1)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+	unavailable := NewError(CodeUnavailable, errors.New("oh no"))
+	assert.True(t, IsRetryable(unavailable))
+	assert.True(t, IsRetryable(fmt.Errorf("wrapped: %w", unavailable)))
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(errors.New("oh no"))) // CodeUnknown
+
+	exhausted := NewError(CodeResourceExhausted, errors.New("slow down"))
+	assert.False(t, IsRetryable(exhausted))
+	assert.True(t, IsRetryable(exhausted, CodeUnavailable, CodeResourceExhausted))
+	assert.False(t, IsRetryable(unavailable, CodeResourceExhausted))
+
+	// Refused streams never reached the server, so they're always retryable.
+	refused := wrapIfRSTError(errors.New("stream error: stream ID 3; REFUSED_STREAM; received from peer"))
+	assert.True(t, IsRetryable(refused, CodeAborted))
+
+	// The caller's own context ending is never retryable.
+	assert.False(t, IsRetryable(wrapIfContextError(context.Canceled), CodeCanceled))
+	assert.False(t, IsRetryable(wrapIfContextError(context.DeadlineExceeded), CodeDeadlineExceeded))
+	// But servers may report the same codes.
+	assert.True(t, IsRetryable(NewError(CodeDeadlineExceeded, errors.New("too slow")), CodeDeadlineExceeded))
+}
+
+// recordingClock records the duration of each timer and fires it
+// immediately.
+type recordingClock struct {
+	systemClock
+
+	waits []time.Duration
+}
+
+func (c *recordingClock) NewTimer(d time.Duration) Timer {
+	c.waits = append(c.waits, d)
+	timer := make(chan time.Time, 1)
+	timer <- time.Time{}
+	return &recordingTimer{c: timer}
+}
+
+type recordingTimer struct {
+	c chan time.Time
+}
+
+func (t *recordingTimer) C() <-chan time.Time { return t.c }
+
+func (t *recordingTimer) Stop() bool { return false }
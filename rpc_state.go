@@ -0,0 +1,65 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"time"
+)
+
+// rpcState is the per-RPC state that clients and handlers attach to the
+// context before any interceptors run. It lives in the context, rather than on
+// the connection, so interceptors that wrap connections don't hide it from the
+// user-facing stream types or from code deep in a handler's call stack.
+// Keeping it in a single struct means each RPC pays for one context value
+// and one allocation, however many features need per-RPC state.
+type rpcState struct {
+	stats  streamStats
+	values streamValues
+	codec  codecName
+
+	// Client state.
+	send                sendState
+	acceptedCompression acceptedCompression
+
+	// Handler state. Outbound calls made with a handler's context inherit
+	// it, so deadline budgets stay relative to the inbound request.
+	metadata   *handlerMetadata // nil outside of handlers
+	clock      Clock            // nil outside of handlers
+	start      time.Time
+	requestEOF *readAheadBody // nil except in bidi handlers
+}
+
+type rpcStateContextKey struct{}
+
+// withRPCState attaches fresh state to the context. RPCs always get their own
+// stats, values, and codec name, even if the context already carries some:
+// handlers commonly pass their context to outbound clients, which may use a
+// different codec.
+func withRPCState(ctx context.Context) (context.Context, *rpcState) {
+	state := &rpcState{}
+	if parent := rpcStateFromContext(ctx); parent != nil {
+		state.metadata = parent.metadata
+		state.clock = parent.clock
+		state.start = parent.start
+	}
+	return context.WithValue(ctx, rpcStateContextKey{}, state), state
+}
+
+// rpcStateFromContext returns the state attached by withRPCState, or nil.
+func rpcStateFromContext(ctx context.Context) *rpcState {
+	state, _ := ctx.Value(rpcStateContextKey{}).(*rpcState)
+	return state
+}
@@ -0,0 +1,258 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcMaxRetryAttempts is the most attempts gRPC allows a service config's
+// retry policy to request. Larger values are silently capped.
+const grpcMaxRetryAttempts = 5
+
+// ServiceConfig is the part of a gRPC service config that Connect clients
+// support. See [ParseServiceConfig].
+type ServiceConfig struct {
+	// MethodConfigs are the config's per-method settings, ready to pass to
+	// [WithMethodConfig].
+	MethodConfigs map[string]MethodConfig
+	// Ignored lists the fields of the config that Connect doesn't support,
+	// like "loadBalancingConfig" or "methodConfig[0].waitForReady". Connect
+	// never logs, so callers that want warnings should log these.
+	Ignored []string
+}
+
+// ParseServiceConfig parses a gRPC service config in its standard JSON form,
+// so clients can share configuration with the rest of the gRPC ecosystem:
+//
+//	config, err := connect.ParseServiceConfig(data)
+//	if err != nil {
+//		return err
+//	}
+//	for _, field := range config.Ignored {
+//		logger.Warn("unsupported service config field", "field", field)
+//	}
+//	client := pingv1connect.NewPingServiceClient(
+//		http.DefaultClient,
+//		"https://api.acme.com",
+//		connect.WithMethodConfig(config.MethodConfigs),
+//	)
+//
+// From each entry in methodConfig, Connect uses the names, timeout,
+// maxRequestMessageBytes, maxResponseMessageBytes, and the retryPolicy's
+// maxAttempts, initialBackoff, maxBackoff, backoffMultiplier, and
+// retryableStatusCodes. As in gRPC, retries use full jitter and make at most
+// five attempts. Everything else is reported in Ignored.
+func ParseServiceConfig(data []byte) (*ServiceConfig, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("service config: %w", err)
+	}
+	config := &ServiceConfig{MethodConfigs: make(map[string]MethodConfig)}
+	for _, key := range sortedKeys(fields) {
+		if normalizeConfigKey(key) != "methodconfig" {
+			config.Ignored = append(config.Ignored, key)
+			continue
+		}
+		var entries []map[string]json.RawMessage
+		if err := json.Unmarshal(fields[key], &entries); err != nil {
+			return nil, fmt.Errorf("service config: methodConfig: %w", err)
+		}
+		for i, entry := range entries {
+			if err := config.addMethodConfig(fmt.Sprintf("methodConfig[%d]", i), entry); err != nil {
+				return nil, fmt.Errorf("service config: %w", err)
+			}
+		}
+	}
+	return config, nil
+}
+
+func (c *ServiceConfig) addMethodConfig(path string, fields map[string]json.RawMessage) error {
+	var (
+		methodConfig MethodConfig
+		names        []string
+	)
+	for _, key := range sortedKeys(fields) {
+		value := fields[key]
+		var err error
+		switch normalizeConfigKey(key) {
+		case "name":
+			names, err = parseMethodConfigNames(value)
+		case "timeout":
+			methodConfig.Timeout, err = parseProtoDuration(value)
+		case "maxrequestmessagebytes":
+			methodConfig.SendMaxBytes, err = parseProtoInt(value)
+		case "maxresponsemessagebytes":
+			methodConfig.ReadMaxBytes, err = parseProtoInt(value)
+		case "retrypolicy":
+			methodConfig.RetryPolicy, err = c.parseRetryPolicy(path+".retryPolicy", value)
+		default:
+			c.Ignored = append(c.Ignored, path+"."+key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", path, key, err)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%s: no names", path)
+	}
+	for _, name := range names {
+		if _, ok := c.MethodConfigs[name]; ok {
+			return fmt.Errorf("%s: duplicate name %q", path, name)
+		}
+		c.MethodConfigs[name] = methodConfig
+	}
+	return nil
+}
+
+// parseMethodConfigNames converts gRPC's names to WithMethodConfig keys.
+func parseMethodConfigNames(data json.RawMessage) ([]string, error) {
+	var names []struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		switch {
+		case name.Service == "" && name.Method != "":
+			return nil, fmt.Errorf("method %q has no service", name.Method)
+		case name.Service == "":
+			keys = append(keys, MethodConfigWildcard)
+		case name.Method == "":
+			keys = append(keys, "/"+name.Service+"/*")
+		default:
+			keys = append(keys, "/"+name.Service+"/"+name.Method)
+		}
+	}
+	return keys, nil
+}
+
+func (c *ServiceConfig) parseRetryPolicy(path string, data json.RawMessage) (*RetryPolicy, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	policy := &RetryPolicy{Jitter: JitterFull}
+	for _, key := range sortedKeys(fields) {
+		value := fields[key]
+		var err error
+		switch normalizeConfigKey(key) {
+		case "maxattempts":
+			policy.MaxAttempts, err = parseProtoInt(value)
+			if policy.MaxAttempts > grpcMaxRetryAttempts {
+				policy.MaxAttempts = grpcMaxRetryAttempts
+			}
+		case "initialbackoff":
+			policy.InitialBackoff, err = parseProtoDuration(value)
+		case "maxbackoff":
+			policy.MaxBackoff, err = parseProtoDuration(value)
+		case "backoffmultiplier":
+			err = json.Unmarshal(value, &policy.BackoffMultiplier)
+		case "retryablestatuscodes":
+			policy.RetryableCodes, err = parseStatusCodes(value)
+		default:
+			c.Ignored = append(c.Ignored, path+"."+key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return policy, nil
+}
+
+// parseStatusCodes accepts gRPC's upper-case code names or numeric codes.
+func parseStatusCodes(data json.RawMessage) ([]Code, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	codes := make([]Code, 0, len(values))
+	for _, value := range values {
+		var number uint32
+		if err := json.Unmarshal(value, &number); err == nil {
+			if number == 0 || number > uint32(maxCode) {
+				return nil, fmt.Errorf("invalid code %d", number)
+			}
+			codes = append(codes, Code(number))
+			continue
+		}
+		var name string
+		if err := json.Unmarshal(value, &name); err != nil {
+			return nil, err
+		}
+		name = strings.ToLower(name)
+		if name == "cancelled" {
+			name = "canceled" // gRPC's spelling
+		}
+		var code Code
+		if err := code.UnmarshalText([]byte(name)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseProtoDuration parses the JSON form of a google.protobuf.Duration,
+// like "1.5s".
+func parseProtoDuration(data json.RawMessage) (time.Duration, error) {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSuffix(text, "s"), 64)
+	if err != nil || !strings.HasSuffix(text, "s") || seconds < 0 || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("invalid duration %q", text)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseProtoInt parses a non-negative integer, which proto3 JSON may encode
+// as a number or a string.
+func parseProtoInt(data json.RawMessage) (int, error) {
+	text := string(bytes.Trim(data, `"`))
+	value, err := strconv.ParseInt(text, 10, 32)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid integer %s", data)
+	}
+	return int(value), nil
+}
+
+// normalizeConfigKey lets field names match regardless of case and
+// underscores. Protobuf's JSON form accepts both "maxAttempts" and
+// "max_attempts", and grpc-go's parser ignores case, so real-world configs
+// use all three spellings.
+func normalizeConfigKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", ""))
+}
+
+func sortedKeys(fields map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+	"time"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestParseServiceConfig(t *testing.T) {
+	t.Parallel()
+	t.Run("retry", func(t *testing.T) {
+		t.Parallel()
+		// Adapted from grpc-go's retry example.
+		config, err := ParseServiceConfig([]byte(`{
+			"methodConfig": [{
+				"name": [{"service": "grpc.examples.echo.Echo"}],
+				"waitForReady": true,
+				"retryPolicy": {
+					"MaxAttempts": 4,
+					"initialBackoff": ".01s",
+					"maxBackoff": "0.5s",
+					"backoffMultiplier": 1.0,
+					"retryableStatusCodes": ["UNAVAILABLE", "CANCELLED", 8]
+				}
+			}]
+		}`))
+		assert.Nil(t, err)
+		assert.Equal(t, config.MethodConfigs, map[string]MethodConfig{
+			"/grpc.examples.echo.Echo/*": {
+				RetryPolicy: &RetryPolicy{
+					MaxAttempts:       4,
+					InitialBackoff:    10 * time.Millisecond,
+					MaxBackoff:        500 * time.Millisecond,
+					BackoffMultiplier: 1,
+					Jitter:            JitterFull,
+					RetryableCodes:    []Code{CodeUnavailable, CodeCanceled, CodeResourceExhausted},
+				},
+			},
+		})
+		assert.Equal(t, config.Ignored, []string{"methodConfig[0].waitForReady"})
+	})
+	t.Run("names_and_limits", func(t *testing.T) {
+		t.Parallel()
+		config, err := ParseServiceConfig([]byte(`{
+			"loadBalancingConfig": [{"round_robin": {}}],
+			"methodConfig": [
+				{
+					"name": [{}],
+					"timeout": "30s"
+				},
+				{
+					"name": [
+						{"service": "acme.foo.v1.FooService", "method": "Upload"},
+						{"service": "acme.foo.v1.FooService", "method": "Download"}
+					],
+					"timeout": "1.5s",
+					"maxRequestMessageBytes": 1048576,
+					"max_response_message_bytes": "4194304",
+					"retryPolicy": {"maxAttempts": 10}
+				}
+			]
+		}`))
+		assert.Nil(t, err)
+		large := MethodConfig{
+			Timeout:      1500 * time.Millisecond,
+			SendMaxBytes: 1 << 20,
+			ReadMaxBytes: 4 << 20,
+			// gRPC caps attempts at five.
+			RetryPolicy: &RetryPolicy{MaxAttempts: 5, Jitter: JitterFull},
+		}
+		assert.Equal(t, config.MethodConfigs, map[string]MethodConfig{
+			MethodConfigWildcard:               {Timeout: 30 * time.Second},
+			"/acme.foo.v1.FooService/Upload":   large,
+			"/acme.foo.v1.FooService/Download": large,
+		})
+		assert.Equal(t, config.Ignored, []string{"loadBalancingConfig"})
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, data := range []string{
+			`[]`,
+			`{"methodConfig": [{"timeout": "1s"}]}`,
+			`{"methodConfig": [{"name": [{"method": "Foo"}]}]}`,
+			`{"methodConfig": [{"name": [{}], "timeout": "1m"}]}`,
+			`{"methodConfig": [{"name": [{}], "maxRequestMessageBytes": -1}]}`,
+			`{"methodConfig": [{"name": [{}], "retryPolicy": {"retryableStatusCodes": ["NOPE"]}}]}`,
+			`{"methodConfig": [{"name": [{}]}, {"name": [{}]}]}`,
+		} {
+			_, err := ParseServiceConfig([]byte(data))
+			assert.NotNil(t, err, assert.Sprintf("%s", data))
+		}
+	})
+}
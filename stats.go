@@ -0,0 +1,150 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// streamStats counts the bytes a single RPC writes to and reads from the
+// network, including envelopes and compression. It's part of the RPC's
+// rpcState.
+//
+// A nil *streamStats is valid and counts nothing.
+type streamStats struct {
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+
+	// Message payload sizes, before and after compression.
+	uncompressedSent     atomic.Int64
+	compressedSent       atomic.Int64
+	uncompressedReceived atomic.Int64
+	compressedReceived   atomic.Int64
+}
+
+// CompressionStats summarizes the effect of compression on the messages of
+// a stream. Compressed sizes are the sizes of the message payloads on the
+// wire, excluding envelopes; for messages sent or received without
+// compression, they're the same as the uncompressed sizes.
+type CompressionStats struct {
+	UncompressedBytesSent     int64
+	CompressedBytesSent       int64
+	UncompressedBytesReceived int64
+	CompressedBytesReceived   int64
+}
+
+func streamStatsFromContext(ctx context.Context) *streamStats {
+	if state := rpcStateFromContext(ctx); state != nil {
+		return &state.stats
+	}
+	return nil
+}
+
+func (s *streamStats) addSent(n int) {
+	if s != nil && n > 0 {
+		s.bytesSent.Add(int64(n))
+	}
+}
+
+func (s *streamStats) addReceived(n int) {
+	if s != nil && n > 0 {
+		s.bytesReceived.Add(int64(n))
+	}
+}
+
+func (s *streamStats) addMessageSent(uncompressed, compressed int) {
+	if s != nil {
+		s.uncompressedSent.Add(int64(uncompressed))
+		s.compressedSent.Add(int64(compressed))
+	}
+}
+
+func (s *streamStats) addMessageReceived(uncompressed, compressed int) {
+	if s != nil {
+		s.uncompressedReceived.Add(int64(uncompressed))
+		s.compressedReceived.Add(int64(compressed))
+	}
+}
+
+func (s *streamStats) compression() CompressionStats {
+	if s == nil {
+		return CompressionStats{}
+	}
+	return CompressionStats{
+		UncompressedBytesSent:     s.uncompressedSent.Load(),
+		CompressedBytesSent:       s.compressedSent.Load(),
+		UncompressedBytesReceived: s.uncompressedReceived.Load(),
+		CompressedBytesReceived:   s.compressedReceived.Load(),
+	}
+}
+
+func (s *streamStats) sent() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.bytesSent.Load()
+}
+
+func (s *streamStats) received() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.bytesReceived.Load()
+}
+
+// countingWriter records the bytes written through it as sent.
+type countingWriter struct {
+	writer io.Writer
+	stats  *streamStats
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.stats.addSent(n)
+	return n, err
+}
+
+// countingReadCloser records the bytes read through it as received.
+type countingReadCloser struct {
+	io.ReadCloser
+
+	stats *streamStats
+}
+
+func (r *countingReadCloser) Read(data []byte) (int, error) {
+	n, err := r.ReadCloser.Read(data)
+	r.stats.addReceived(n)
+	return n, err
+}
+
+// countWrites wraps the writer to record bytes sent. If stats is nil, it
+// returns the writer unchanged.
+func countWrites(writer io.Writer, stats *streamStats) io.Writer {
+	if stats == nil {
+		return writer
+	}
+	return &countingWriter{writer: writer, stats: stats}
+}
+
+// countReads wraps the reader to record bytes received. If stats is nil, it
+// returns the reader unchanged.
+func countReads(reader io.ReadCloser, stats *streamStats) io.ReadCloser {
+	if stats == nil {
+		return reader
+	}
+	return &countingReadCloser{ReadCloser: reader, stats: stats}
+}
@@ -0,0 +1,86 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	statusv1 "connectrpc.com/connect/internal/gen/connectext/grpc/status/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SetSuccessDetails attaches structured details to a successful response by
+// encoding them into the response trailers, where clients can read them with
+// [SuccessDetails]. Handlers typically pass the trailers from
+// [Response].Trailer or the ResponseTrailer method of a stream.
+//
+// Success details use the same Grpc-Status-Details-Bin trailer that gRPC
+// uses for error details, encoded as a google.rpc.Status with an OK code, so
+// gRPC clients in other languages can read them too. They're sent with every
+// protocol. Success details only describe successful RPCs: if the handler
+// returns an error, clients should use the error's details, available from
+// [Error].Details. (With the gRPC protocols, the error's details replace the
+// success details on the wire.)
+//
+// Calling SetSuccessDetails with no details removes any previously set.
+func SetSuccessDetails(trailer http.Header, details ...*ErrorDetail) error {
+	if len(details) == 0 {
+		delHeaderCanonical(trailer, grpcHeaderDetails)
+		return nil
+	}
+	status := &statusv1.Status{Code: 0}
+	for _, detail := range details {
+		status.Details = append(status.Details, detail.pb)
+	}
+	bin, err := proto.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("marshal success details: %w", err)
+	}
+	setHeaderCanonical(trailer, grpcHeaderDetails, EncodeBinaryHeader(bin))
+	return nil
+}
+
+// SuccessDetails returns the details a handler attached to a successful
+// response with [SetSuccessDetails]. Clients typically pass the trailers from
+// [Response].Trailer or the ResponseTrailer method of a stream, after the
+// response has been received in full. If the trailers don't contain any
+// details, SuccessDetails returns nil.
+//
+// Errors carry their own details, available from [Error].Details, so
+// SuccessDetails returns an error if the trailers describe a failed RPC.
+func SuccessDetails(trailer http.Header) ([]*ErrorDetail, error) {
+	encoded := getHeaderCanonical(trailer, grpcHeaderDetails)
+	if encoded == "" {
+		return nil, nil
+	}
+	bin, err := DecodeBinaryHeader(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s trailer: %w", grpcHeaderDetails, err)
+	}
+	var status statusv1.Status
+	if err := proto.Unmarshal(bin, &status); err != nil {
+		return nil, fmt.Errorf("invalid protobuf in %s trailer: %w", grpcHeaderDetails, err)
+	}
+	if status.Code != 0 {
+		return nil, errors.New("trailers describe a failed RPC, not success details")
+	}
+	details := make([]*ErrorDetail, 0, len(status.Details))
+	for _, detail := range status.Details {
+		details = append(details, &ErrorDetail{pb: detail})
+	}
+	return details, nil
+}
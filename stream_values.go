@@ -0,0 +1,73 @@
+// Copyright 2021-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+)
+
+// WithStreamValue stores a value in the per-RPC value bag carried by ctx.
+// Clients and handlers attach a fresh bag to the context of every RPC before
+// any interceptors run, so interceptors can use the bag to pass state, like a
+// span or a start time, between the request and response sides of a single
+// RPC without colliding with application context values.
+//
+// Within an RPC, WithStreamValue stores the value in place and returns ctx
+// unchanged, so every holder of the RPC's context sees it. Outside of an RPC,
+// it returns a new context with a new bag.
+//
+// The bag is safe for concurrent use, so streaming interceptors may read and
+// write it from both the sending and receiving goroutines. As with
+// [context.WithValue], keys should be of an unexported type.
+func WithStreamValue(ctx context.Context, key, value any) context.Context {
+	state := rpcStateFromContext(ctx)
+	if state == nil {
+		ctx, state = withRPCState(ctx)
+	}
+	state.values.set(key, value)
+	return ctx
+}
+
+// StreamValue returns the value stored under key with [WithStreamValue] in the
+// per-RPC value bag carried by ctx, or nil if there's no such value.
+func StreamValue(ctx context.Context, key any) any {
+	state := rpcStateFromContext(ctx)
+	if state == nil {
+		return nil
+	}
+	return state.values.get(key)
+}
+
+// streamValues is the per-RPC value bag. It's part of the RPC's rpcState.
+type streamValues struct {
+	mu     sync.Mutex
+	values map[any]any
+}
+
+func (v *streamValues) set(key, value any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.values == nil {
+		v.values = make(map[any]any)
+	}
+	v.values[key] = value
+}
+
+func (v *streamValues) get(key any) any {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[key]
+}